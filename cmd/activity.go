@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	cmdActivity = &cobra.Command{
+		Use:   "activity <service-account>",
+		Short: "show AWS API calls made with IRSA role sessions of the service account",
+		Long:  "",
+		Args:  cobra.ExactArgs(1),
+		Run:   runActivityCmd,
+	}
+)
+
+var activitySessions int
+
+func init() {
+	cmdActivity.Flags().IntVar(
+		&activitySessions,
+		"sessions",
+		10,
+		"maximum number of the latest role sessions to look up events for, minimum is 1, each session is a separate cloudtrail lookup",
+	)
+	RootCmd.AddCommand(cmdActivity)
+}
+
+func runActivityCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+	if activitySessions < 1 {
+		fmt.Printf("sessions %d is less than 1\n", activitySessions)
+		os.Exit(1)
+	}
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// role sessions are created only by IRSA, pod identity associations are not needed
+	sa, err := k8sClient.GetServiceAccount(GlobalFlags.namespace, args[0], nil)
+	if err != nil {
+		fmt.Printf("get service account %s/%s: %v\n", GlobalFlags.namespace, args[0], err)
+		os.Exit(1)
+	}
+	if sa.IamRoleArn == "" {
+		fmt.Printf("service account %s/%s does not have %s annotation\n", sa.Namespace, sa.Name, "eks.amazonaws.com/role-arn")
+		os.Exit(1)
+	}
+
+	report, err := getActivity(logger, awsClient, sa, GlobalFlags.EventsFilter(), activitySessions)
+	if err != nil {
+		fmt.Printf("activity: %v\n", err)
+		os.Exit(1)
+	}
+	GlobalFlags.Output(logger).Print(KindActivityReport, report, func() { printActivity(logger, report) })
+}
+
+// getActivity returns API calls made by the latest role sessions of the service account
+func getActivity(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, filter aws.EventsFilter, maxSessions int) (ActivityReport, error) {
+	sessions, err := lookupSessionEvents(logger, awsClient, sa, filter, maxSessions)
+	if err != nil {
+		return ActivityReport{}, err
+	}
+
+	report := ActivityReport{Namespace: sa.Namespace, Name: sa.Name, RoleArn: sa.IamRoleArn, TotalSessions: sessions.Total, Sessions: []ActivitySession{}}
+	for i, session := range sessions.Sessions {
+		report.Sessions = append(report.Sessions, toActivitySession(session, sessions.Counts[i]))
+	}
+	report.Actions = toActionActivityDetails(sessions.Events.Activity())
+	report.Errors = toEventDetails(sessions.Events.FailedEvents())
+	return report, nil
+}
+
+// sessionEvents are events of the looked up role sessions, Counts are number of events per session and Total is
+// number of all sessions in the time window
+type sessionEvents struct {
+	Sessions []aws.Session
+	Counts   []int
+	Total    int
+	Events   aws.Events
+}
+
+// lookupSessionEvents looks up successful AssumeRoleWithWebIdentity events of the service account, and then events
+// made by the latest assumed role sessions (latest first). Event name and source filters are applied only to the
+// session events.
+func lookupSessionEvents(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, filter aws.EventsFilter, maxSessions int) (sessionEvents, error) {
+	webIdentityFilter := aws.EventsFilter{StartTime: filter.StartTime, EndTime: filter.EndTime}
+	events, err := awsClient.LookupEvents(sa.Namespace, sa.Name, webIdentityFilter)
+	if err != nil {
+		return sessionEvents{}, err
+	}
+
+	sessions := events.Sessions()
+	out := sessionEvents{Total: len(sessions)}
+	for _, session := range sessions[:min(maxSessions, len(sessions))] {
+		se, err := awsClient.LookupSessionEvents(session, filter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("%s session events: %v", session.AssumedRoleArn, err))
+			continue
+		}
+		out.Sessions = append(out.Sessions, session)
+		out.Counts = append(out.Counts, len(se))
+		out.Events = append(out.Events, se...)
+	}
+	// sessions are looked up separately
+	slices.SortStableFunc(out.Events, func(a, b aws.Event) int { return b.EventTime.Compare(a.EventTime) })
+	return out, nil
+}
+
+func printActivity(logger *slog.Logger, report ActivityReport) {
+	fmt.Printf("Service Account: %s/%s\n", report.Namespace, report.Name)
+	fmt.Printf("Role:            %s\n", report.RoleArn)
+	if len(report.Sessions) == 0 {
+		fmt.Println("no successful AssumeRoleWithWebIdentity events found")
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("Sessions (%d/%d):\n", len(report.Sessions), report.TotalSessions)
+	table := out.NewTable(logger)
+	table.AddRow("SESSION", "FIRST SEEN", "LAST SEEN", "ASSUMED", "EVENTS")
+	for _, session := range report.Sessions {
+		table.AddRow(session.RoleSessionName, session.FirstSeen.Format(time.RFC3339), session.LastSeen.Format(time.RFC3339),
+			strconv.Itoa(session.Assumed), strconv.Itoa(session.Events))
+	}
+	table.Print()
+
+	if len(report.Actions) == 0 {
+		fmt.Println()
+		fmt.Println("no API calls found for the sessions")
+		return
+	}
+	fmt.Println()
+	fmt.Println("Activity:")
+	table = out.NewTable(logger)
+	table.AddRow("SERVICE", "ACTION", "CALLS", "ERRORS", "LAST SEEN", "ERROR CODES")
+	for _, action := range report.Actions {
+		table.AddRow(action.Service, action.Action, strconv.Itoa(action.Count), strconv.Itoa(action.Errors),
+			action.LastSeen.Format(time.RFC3339), strings.Join(action.ErrorCodes, ","))
+	}
+	table.Print()
+
+	if len(report.Errors) != 0 {
+		fmt.Println()
+		fmt.Println("Errors:")
+		table = out.NewTable(logger)
+		table.AddRow("TIME", "ACTION", "CODE", "MESSAGE")
+		for i, event := range report.Errors {
+			// print max last 5 errors
+			if i == 5 {
+				break
+			}
+			table.AddRow(event.EventTime.Format(time.RFC3339), event.EventName, event.ErrorCode, event.ErrorMessage)
+		}
+		table.Print()
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	cmdAudit = &cobra.Command{
+		Use:   "audit",
+		Short: "report orphan and dangling IAM roles and service accounts",
+		Long:  "",
+		Run:   runAuditCmd,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(cmdAudit)
+}
+
+// audit categories, in the order they are printed
+const (
+	AuditMissingRole            = "missing role"
+	AuditUnusedRole             = "unused role"
+	AuditDeletedClusterProvider = "deleted cluster provider"
+	AuditNoPods                 = "no pods"
+)
+
+var auditCategories = []string{AuditMissingRole, AuditUnusedRole, AuditDeletedClusterProvider, AuditNoPods}
+
+// auditInput is cluster and account state cross-referenced by the audit, Clusters are EKS clusters in the client
+// region and are nil if they could not be listed
+type auditInput struct {
+	Cluster         aws.Cluster
+	Account         string
+	Region          string
+	ServiceAccounts []k8s.ServiceAccount
+	Roles           []aws.Role
+	ProviderArns    []string
+	Clusters        []aws.Cluster
+}
+
+func runAuditCmd(_ *cobra.Command, _ []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	input, err := getAuditInput(logger, k8sClient, awsClient)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	findings := auditServiceAccounts(logger, awsClient, input)
+	findings = append(findings, auditRoles(input)...)
+	sortAuditFindings(findings)
+	report := AuditReport{Cluster: input.Cluster.Name, Findings: findings}
+	GlobalFlags.Output(logger).Print(KindAuditReport, report, func() { printAudit(logger, report) })
+}
+
+// getAuditInput lists service accounts in all namespaces (audit needs all service accounts to find unused roles),
+// roles and oidc providers in the caller account and clusters in the region
+func getAuditInput(logger *slog.Logger, k8sClient k8s.Client, awsClient aws.Client) (auditInput, error) {
+	cluster, err := awsClient.DescribeCluster()
+	if err != nil {
+		return auditInput{}, fmt.Errorf("describe cluster: %w", err)
+	}
+
+	associations := listPodIdentityAssociations(logger, awsClient, "")
+	sas, err := k8sClient.ListIAMServiceAccounts("", "", "", associations)
+	if err != nil {
+		return auditInput{}, fmt.Errorf("list service accounts: %w", err)
+	}
+	roles, err := awsClient.ListIAMRoles()
+	if err != nil {
+		return auditInput{}, fmt.Errorf("list roles: %w", err)
+	}
+	providerArns, err := awsClient.ListOidcProviderArns()
+	if err != nil {
+		return auditInput{}, fmt.Errorf("list oidc providers: %w", err)
+	}
+	clusters, err := awsClient.ListClusters()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("list clusters: %v, skipping deleted cluster check for existing providers", err))
+	}
+
+	return auditInput{
+		Cluster:         cluster,
+		Account:         awsClient.Account(),
+		Region:          awsClient.Region(),
+		ServiceAccounts: sas,
+		Roles:           roles,
+		ProviderArns:    providerArns,
+		Clusters:        clusters,
+	}, nil
+}
+
+// auditServiceAccounts reports service accounts with roles that do not exist, and service accounts without pods. Roles
+// in the caller account are looked up in the listed roles, roles in other accounts are fetched.
+func auditServiceAccounts(logger *slog.Logger, awsClient aws.Client, input auditInput) []AuditFinding {
+	var findings []AuditFinding
+	for _, sa := range input.ServiceAccounts {
+		for _, roleArn := range []string{sa.IamRoleArn, sa.PodIdentityRoleArn} {
+			if roleArn == "" || auditRoleExists(logger, awsClient, input, roleArn) {
+				continue
+			}
+			findings = append(findings, AuditFinding{
+				Category:       AuditMissingRole,
+				Namespace:      sa.Namespace,
+				ServiceAccount: sa.Name,
+				RoleArn:        roleArn,
+				Detail:         "role does not exist",
+			})
+		}
+		if len(sa.Pods) == 0 {
+			findings = append(findings, AuditFinding{
+				Category:       AuditNoPods,
+				Namespace:      sa.Namespace,
+				ServiceAccount: sa.Name,
+				RoleArn:        cmp.Or(sa.IamRoleArn, sa.PodIdentityRoleArn),
+				Detail:         "service account is not used by any pod",
+			})
+		}
+	}
+	return findings
+}
+
+// auditRoleExists returns true if the role exists, or if it cannot be determined (e.g. foreign account)
+func auditRoleExists(logger *slog.Logger, awsClient aws.Client, input auditInput, roleArn string) bool {
+	if slices.ContainsFunc(input.Roles, func(role aws.Role) bool { return strings.EqualFold(role.ARN, roleArn) }) {
+		return true
+	}
+	if err := aws.ValidateRoleArn(roleArn); err != nil {
+		return false
+	}
+	if a, _ := arn.Parse(roleArn); a.AccountID == input.Account {
+		return false
+	}
+
+	_, err := awsClient.GetIAMRole(roleArn)
+	var errNotFound *errs.ErrNotFound
+	if errors.As(err, &errNotFound) {
+		return false
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("get role %s: %v", roleArn, err))
+	}
+	return true
+}
+
+// auditRoles reports roles that trust this cluster oidc provider, but are not used by any service account, and roles
+// that trust oidc providers that do not exist or that do not belong to any cluster in the region
+func auditRoles(input auditInput) []AuditFinding {
+	clusterProviderArn := input.Cluster.OidcProviderArn()
+	var findings []AuditFinding
+	for _, role := range input.Roles {
+		policy, err := aws.ParsePolicyDocument(role.AssumeRolePolicyDocument)
+		if err != nil {
+			continue
+		}
+		for _, providerArn := range policy.WebIdentityProviders() {
+			if strings.EqualFold(providerArn, clusterProviderArn) {
+				if !auditRoleUsed(input.ServiceAccounts, role.ARN) {
+					findings = append(findings, AuditFinding{
+						Category: AuditUnusedRole,
+						RoleArn:  role.ARN,
+						Detail:   fmt.Sprintf("role trusts %s cluster oidc provider, but no service account uses it", input.Cluster.Name),
+					})
+				}
+				continue
+			}
+			if detail, ok := auditDeletedClusterProvider(input, providerArn); ok {
+				findings = append(findings, AuditFinding{Category: AuditDeletedClusterProvider, RoleArn: role.ARN, Detail: detail})
+			}
+		}
+	}
+	return findings
+}
+
+func auditRoleUsed(sas []k8s.ServiceAccount, roleArn string) bool {
+	return slices.ContainsFunc(sas, func(sa k8s.ServiceAccount) bool { return strings.EqualFold(sa.IamRoleArn, roleArn) })
+}
+
+// auditDeletedClusterProvider returns detail if the EKS oidc provider in the caller account does not exist, or if the
+// provider is in the client region and no cluster in the region has its issuer
+func auditDeletedClusterProvider(input auditInput, providerArn string) (string, bool) {
+	region, issuerHost, ok := aws.EksOidcProvider(providerArn)
+	if a, _ := arn.Parse(providerArn); !ok || a.AccountID != input.Account {
+		return "", false
+	}
+	if !slices.ContainsFunc(input.ProviderArns, func(v string) bool { return strings.EqualFold(v, providerArn) }) {
+		return fmt.Sprintf("trusted oidc provider %s does not exist", providerArn), true
+	}
+	if region != input.Region || input.Clusters == nil {
+		return "", false
+	}
+	if slices.ContainsFunc(input.Clusters, func(c aws.Cluster) bool { return strings.EqualFold(c.OidcIssuerHost(), issuerHost) }) {
+		return "", false
+	}
+	return fmt.Sprintf("trusted oidc provider %s does not belong to any cluster in %s region", providerArn, region), true
+}
+
+func sortAuditFindings(findings []AuditFinding) {
+	slices.SortStableFunc(findings, func(a, b AuditFinding) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(auditCategories, a.Category), slices.Index(auditCategories, b.Category)),
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.ServiceAccount, b.ServiceAccount),
+			cmp.Compare(a.RoleArn, b.RoleArn),
+		)
+	})
+}
+
+func printAudit(logger *slog.Logger, report AuditReport) {
+	table := out.NewTable(logger)
+	table.AddRow("CATEGORY", "NAMESPACE", "SERVICE ACCOUNT", "IAM ROLE", "DETAIL")
+	for _, finding := range report.Findings {
+		table.AddRow(finding.Category, finding.Namespace, finding.ServiceAccount, finding.RoleArn, finding.Detail)
+	}
+	table.Print()
+
+	counts := make(map[string]int)
+	for _, finding := range report.Findings {
+		counts[finding.Category]++
+	}
+	fmt.Println()
+	for _, category := range auditCategories {
+		fmt.Printf("%s: %d\n", category, counts[category])
+	}
+}
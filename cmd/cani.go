@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	cmdCanI = &cobra.Command{
+		Use:   "can-i <service-account> <action> <resource>",
+		Short: "check if IAM service account role can perform action on resource",
+		Long:  "",
+		Args:  cobra.ExactArgs(3),
+		Run:   runCanICmd,
+	}
+)
+
+var (
+	canISimulate       bool
+	canIRequestContext []string
+)
+
+func init() {
+	cmdCanI.Flags().BoolVar(
+		&canISimulate,
+		"simulate",
+		false,
+		"cross-check local evaluation with IAM policy simulator (iam:SimulatePrincipalPolicy)",
+	)
+	cmdCanI.Flags().StringArrayVar(
+		&canIRequestContext,
+		"request-context",
+		nil,
+		"request condition context key=value[,value], e.g. aws:SourceIp=10.0.0.1, can be set multiple times",
+	)
+	RootCmd.AddCommand(cmdCanI)
+}
+
+func runCanICmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	associations := listPodIdentityAssociations(logger, awsClient, GlobalFlags.namespace)
+	sa, err := k8sClient.GetServiceAccount(GlobalFlags.namespace, args[0], associations)
+	if err != nil {
+		fmt.Printf("get service account %s/%s: %v\n", GlobalFlags.namespace, args[0], err)
+		os.Exit(1)
+	}
+	if sa.RoleArn() == "" {
+		fmt.Printf("service account %s/%s does not have IAM role\n", sa.Namespace, sa.Name)
+		os.Exit(1)
+	}
+
+	requestContext, err := parseRequestContext(canIRequestContext, sa.RoleArn(), sa.RoleAccount(), time.Now())
+	if err != nil {
+		fmt.Printf("invalid context: %v\n", err)
+		os.Exit(1)
+	}
+	request := aws.PermissionRequest{Action: args[1], Resource: args[2], Context: requestContext}
+
+	report, err := canI(logger, awsClient, sa, request, canISimulate)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	GlobalFlags.Output(logger).Print(KindCanIReport, report, func() { printCanI(report) })
+	if !report.Allowed {
+		os.Exit(1)
+	}
+}
+
+func canI(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, request aws.PermissionRequest, simulate bool) (CanIReport, error) {
+	role, err := awsClient.GetIAMRole(sa.RoleArn())
+	if err != nil {
+		return CanIReport{}, fmt.Errorf("get role %s: %w", sa.RoleArn(), err)
+	}
+	policies, err := awsClient.GetIAMRolePolicies(role)
+	if err != nil {
+		return CanIReport{}, fmt.Errorf("get role %s policies: %w", sa.RoleArn(), err)
+	}
+
+	verdict := aws.EvaluatePermission(policies, request)
+	report := toCanIReport(sa, request, verdict)
+	if simulate {
+		simulation, err := awsClient.SimulatePrincipalPolicy(sa.RoleArn(), request)
+		if err != nil {
+			logger.Error(fmt.Sprintf("simulate principal policy: %v", err))
+			return report, nil
+		}
+		report.Simulation = &SimulationDetail{
+			Decision:          string(simulation.Decision),
+			MatchedStatements: simulation.MatchedStatements,
+			Match:             simulation.Decision == verdict.Decision,
+		}
+	}
+	return report, nil
+}
+
+// parseRequestContext returns condition context with principal and time keys set, supplied key=value pairs override
+// the defaults
+func parseRequestContext(values []string, roleArn, account string, now time.Time) (map[string][]string, error) {
+	out := map[string][]string{
+		"aws:PrincipalArn":     {roleArn},
+		"aws:PrincipalAccount": {account},
+		"aws:PrincipalType":    {"AssumedRole"},
+		"aws:CurrentTime":      {now.UTC().Format(time.RFC3339)},
+		"aws:EpochTime":        {strconv.FormatInt(now.Unix(), 10)},
+		"aws:SecureTransport":  {"true"},
+	}
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s: expected key=value", value)
+		}
+		for k := range out {
+			if strings.EqualFold(k, key) {
+				delete(out, k)
+			}
+		}
+		out[key] = strings.Split(v, ",")
+	}
+	return out, nil
+}
+
+func printCanI(report CanIReport) {
+	if report.Allowed {
+		fmt.Println("yes")
+	} else {
+		fmt.Println("no")
+	}
+	fmt.Printf("%s %s on %s: %s\n", report.RoleArn, report.Action, report.Resource, report.Reason)
+	for _, note := range report.Notes {
+		fmt.Printf("  note: %s\n", note)
+	}
+	if report.Simulation == nil {
+		return
+	}
+	result := "matches"
+	if !report.Simulation.Match {
+		result = "DOES NOT match"
+	}
+	fmt.Printf("IAM policy simulator: %s, %s local evaluation %s\n", report.Simulation.Decision, result, report.Decision)
+	for _, statement := range report.Simulation.MatchedStatements {
+		fmt.Printf("  matched: %s\n", statement)
+	}
+}
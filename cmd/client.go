@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"log/slog"
+)
+
+// newAWSClient returns AWS client for the kubeconfig cluster, credentials are loaded with kubeconfig (or flags) profile
+// and role. If the cluster name could not be resolved from kubeconfig (e.g. static token or unknown exec plugin), the
+// cluster is looked up by api server endpoint. CloudTrail events are read from --events-from files, or queried in
+// --event-store event data store, if set.
+func newAWSClient(logger *slog.Logger, kubeconfig k8s.Kubeconfig) (aws.Client, error) {
+	credentials := aws.Credentials{Profile: kubeconfig.Profile, RoleArn: kubeconfig.RoleArn, CrossAccount: GlobalFlags.CrossAccount()}
+	awsClient, err := aws.NewClient(logger, kubeconfig.Region, kubeconfig.ClusterName, credentials)
+	if err != nil {
+		return aws.Client{}, err
+	}
+	if source := GlobalFlags.EventSource(logger); source != nil {
+		awsClient = awsClient.WithEventSource(source)
+	}
+	if kubeconfig.ClusterAccount != "" && kubeconfig.ClusterAccount != awsClient.Account() {
+		logger.Warn(fmt.Sprintf("aws caller account %s is different from cluster %s account %s, set --aws-profile or --assume-role flag to query the cluster account",
+			awsClient.Account(), kubeconfig.ClusterName, kubeconfig.ClusterAccount))
+	}
+	if kubeconfig.ClusterName == "" {
+		clusterName, err := awsClient.FindClusterName(kubeconfig.Server)
+		if err != nil {
+			return aws.Client{}, fmt.Errorf("cannot determine cluster name from %s context, set --cluster-name flag: %w", kubeconfig.Context, err)
+		}
+		logger.Debug(fmt.Sprintf("resolved cluster name %s from %s endpoint", clusterName, kubeconfig.Server))
+		awsClient = awsClient.WithClusterName(clusterName)
+	}
+	return withEventStore(awsClient)
+}
+
+// withEventStore returns client that queries --event-store event data store, if set. Event data store of organization
+// trail has events of all clusters, web identity events are scoped to the cluster oidc issuer.
+func withEventStore(awsClient aws.Client) (aws.Client, error) {
+	eventStore := GlobalFlags.EventStore()
+	if eventStore == "" {
+		return awsClient, nil
+	}
+	cluster, err := awsClient.DescribeCluster()
+	if err != nil {
+		return aws.Client{}, fmt.Errorf("event store: %w", err)
+	}
+	return awsClient.WithEventStore(eventStore, cluster.OidcIssuerHost())
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/pete911/kubectl-iam4sa/internal/aws"
 	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
 	"github.com/spf13/cobra"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -29,7 +32,7 @@ func runClusterCmd(_ *cobra.Command, args []string) {
 	kubeconfig := GlobalFlags.Kubeconfig()
 
 	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
-	awsClient, err := aws.NewClient(logger, kubeconfig.Region, kubeconfig.ClusterName)
+	awsClient, err := newAWSClient(logger, kubeconfig)
 	if err != nil {
 		fmt.Printf("aws client: %v\n", err)
 		os.Exit(1)
@@ -41,45 +44,253 @@ func runClusterCmd(_ *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	oidcProvider, err := awsClient.GetClusterOidcProvider(cluster.OidcIssuerId())
-	if err != nil {
+	// providers are listed once, for duplicates check and for provider lookup if it is not found by the derived arn
+	matches, matchesErr := awsClient.FindOidcProviders(cluster)
+	var oidcProvider aws.OidcProvider
+	var providerErr error
+	if matchesErr != nil {
+		logger.Warn(fmt.Sprintf("find oidc providers: %v", matchesErr))
+		oidcProvider, providerErr = awsClient.GetClusterOidcProvider(cluster)
+	} else {
+		oidcProvider, providerErr = awsClient.GetMatchedClusterOidcProvider(cluster, matches)
+	}
+	if providerErr != nil {
 		// continue if the error is not found, we want to display to the user that there's no oidc provider
 		var errNotFound *errs.ErrNotFound
-		if !errors.As(err, &errNotFound) {
-			fmt.Printf("get cluster oidc provider: %v\n", err)
+		if !errors.As(providerErr, &errNotFound) {
+			fmt.Printf("get cluster oidc provider: %v\n", providerErr)
 			os.Exit(1)
 		}
 	}
-	printCluster(logger, cluster, oidcProvider)
+
+	chain, chainErr := aws.CertificateChain(cluster.OidcIssuer, false)
+	discovery := getOidcDiscoveryDetail(cluster.OidcIssuer)
+	item := toClusterDetail(cluster, chain, discovery, oidcProvider, time.Now())
+
+	var checks Checks
+	checkOidcDiscovery(&checks, discovery)
+	checkCertificateChain(&checks, item.OidcIssuer.Certificates, chainErr)
+	if providerErr != nil {
+		checkOidcProviderError(&checks, cluster, providerErr)
+	} else {
+		var fingerprint string
+		if len(chain) != 0 {
+			fingerprint = chain[len(chain)-1].FingerprintSHA1
+		}
+		checkOidcProviderConfig(&checks, cluster, oidcProvider, getClusterAudiences(logger, kubeconfig), fingerprint, chainErr)
+	}
+	if matchesErr == nil {
+		item.DuplicateOidcProviders = matches.Duplicates(oidcProvider.Arn)
+		item.NearOidcProviders = matches.Near
+		checkOidcProviderMatches(&checks, item.DuplicateOidcProviders, item.NearOidcProviders)
+	}
+	item.Failed = checks.Failed()
+	item.Checks = checks
+
+	GlobalFlags.Output(logger).Print(KindCluster, item, func() { printCluster(item) })
+	if item.Failed {
+		os.Exit(1)
+	}
+}
+
+// checkOidcDiscovery fails if the discovery document or JWKS could not be fetched, or the discovery issuer is not the
+// cluster oidc issuer, STS validates tokens against the discovery document and keys
+func checkOidcDiscovery(checks *Checks, discovery *OidcDiscoveryDetail) {
+	name := "oidc issuer discovery"
+	switch {
+	case discovery.Error != "":
+		checks.Fail(name, fmt.Sprintf("%s: %s", discovery.Url, discovery.Error), "verify network access to the oidc issuer")
+	case !discovery.IssuerMatch:
+		checks.Fail(name, fmt.Sprintf("discovery issuer %s does not match cluster oidc issuer", discovery.Issuer),
+			"tokens issued by the cluster are rejected by STS, verify the cluster oidc issuer configuration")
+	default:
+		checks.Pass(name, fmt.Sprintf("%d keys", len(discovery.Keys)))
+	}
+}
+
+// checkCertificateChain fails if the oidc issuer certificate chain could not be fetched or any certificate is expired
+func checkCertificateChain(checks *Checks, certificates []CertificateDetail, err error) {
+	name := "oidc issuer certificates"
+	if err != nil {
+		checks.Fail(name, fmt.Sprintf("oidc issuer certificate chain: %v", err), "verify network access to the oidc issuer")
+		return
+	}
+	var expired []string
+	for _, certificate := range certificates {
+		if certificate.Expired {
+			expired = append(expired, certificate.Subject)
+		}
+	}
+	if len(expired) != 0 {
+		checks.Fail(name, fmt.Sprintf("expired certificates %s", strings.Join(expired, ", ")),
+			"STS rejects tokens if the oidc issuer certificate chain is not valid")
+		return
+	}
+	checks.Pass(name, fmt.Sprintf("%d certificates", len(certificates)))
+}
+
+func checkOidcProviderMatches(checks *Checks, duplicates, near []string) {
+	name := "iam oidc provider duplicates"
+	if len(duplicates) != 0 {
+		checks.Warn(name, fmt.Sprintf("providers with the same url: %s", strings.Join(duplicates, ", ")),
+			"trust policies should reference only one provider, delete unused duplicate providers")
+		return
+	}
+	if len(near) != 0 {
+		checks.Warn(name, fmt.Sprintf("providers with similar url: %s", strings.Join(near, ", ")),
+			"providers of deleted or recreated clusters, or typo in issuer id, verify trust policies and delete unused providers")
+		return
+	}
+	checks.Pass(name, "no duplicate or similar providers")
+}
+
+// getClusterAudiences returns distinct token audiences used by IRSA service accounts in the cluster, default audience
+// is returned if there are no IRSA service accounts, or they cannot be listed
+func getClusterAudiences(logger *slog.Logger, kubeconfig k8s.Kubeconfig) []string {
+	defaultAudiences := []string{aws.DefaultAudience}
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("k8s client: %v, validating only %s audience", err, aws.DefaultAudience))
+		return defaultAudiences
+	}
+	serviceAccounts, err := k8sClient.ListIAMServiceAccounts("", "", "", nil)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("list service accounts: %v, validating only %s audience", err, aws.DefaultAudience))
+		return defaultAudiences
+	}
+
+	var audiences []string
+	for _, sa := range serviceAccounts {
+		if sa.IamRoleArn == "" {
+			continue
+		}
+		if audience := getTokenAudience(sa, ""); !slices.Contains(audiences, audience) {
+			audiences = append(audiences, audience)
+		}
+	}
+	if len(audiences) == 0 {
+		return defaultAudiences
+	}
+	slices.Sort(audiences)
+	return audiences
 }
 
-func printCluster(logger *slog.Logger, cluster aws.Cluster, oidcProvider aws.OidcProvider) {
-	fingerprint, err := cluster.OidcIssuerFingerprint()
+// getOidcDiscoveryDetail fetches issuer discovery document and JWKS, errors are set on the returned detail, so they
+// can be displayed along with the rest of the cluster information
+func getOidcDiscoveryDetail(issuer string) *OidcDiscoveryDetail {
+	discovery, err := aws.GetOidcDiscovery(issuer)
+	if err != nil {
+		return &OidcDiscoveryDetail{Url: aws.DiscoveryUrl(issuer), Error: err.Error()}
+	}
+	jwks, err := aws.GetJWKS(discovery.JwksUri)
+	out := toOidcDiscoveryDetail(issuer, discovery, jwks)
 	if err != nil {
-		logger.Error(fmt.Sprintf("oidc cluster issuer fingerprint: %v", err))
+		out.Error = err.Error()
 	}
+	return out
+}
 
-	fmt.Printf("Name:        %s\n", cluster.Name)
-	fmt.Printf("Status:      %s\n", cluster.Status)
-	fmt.Printf("Endpoint:    %s\n", cluster.Endpoint)
-	fmt.Printf("Created:     %s\n", cluster.CreatedAt.Format(time.RFC3339))
+func printCluster(item ClusterDetail) {
+	printClusterInfo(item)
+	printOidcProviderMatches(item)
+	fmt.Println()
+	fmt.Println("Verdict:")
+	printChecks(item.Checks)
+}
+
+func printClusterInfo(item ClusterDetail) {
+	fmt.Printf("Name:        %s\n", item.Name)
+	fmt.Printf("Status:      %s\n", item.Status)
+	fmt.Printf("Endpoint:    %s\n", item.Endpoint)
+	fmt.Printf("Created:     %s\n", item.CreatedAt.Format(time.RFC3339))
 	fmt.Println("OIDC Issuer:")
-	fmt.Printf("  Url:         %s\n", cluster.OidcIssuer)
-	fmt.Printf("  Thumbprint:  %s\n", fingerprint)
-	if oidcProvider.Url == "" {
+	fmt.Printf("  Url:         %s\n", item.OidcIssuer.Url)
+	fmt.Printf("  Thumbprint:  %s\n", item.OidcIssuer.Thumbprint)
+	printOidcDiscovery(item.OidcIssuer.Discovery)
+	fmt.Println("  Certificates:")
+	for _, certificate := range item.OidcIssuer.Certificates {
+		fmt.Printf("    %s%s\n", certificate.Subject, certificateFlags(certificate))
+		fmt.Printf("      Issuer:    %s\n", certificate.Issuer)
+		fmt.Printf("      Validity:  %s - %s\n", certificate.NotBefore.Format(time.RFC3339), certificate.NotAfter.Format(time.RFC3339))
+		fmt.Printf("      SHA1:      %s\n", certificate.SHA1)
+		fmt.Printf("      SHA256:    %s\n", certificate.SHA256)
+	}
+	if item.OidcProvider == nil {
 		fmt.Println("OIDC Provider: not found")
 		return
 	}
 	fmt.Println("OIDC Provider:")
-	fmt.Printf("  Arn:         %s\n", oidcProvider.Arn)
-	fmt.Printf("  Url:         %s\n", oidcProvider.Url)
-	fmt.Printf("  Created:     %s\n", oidcProvider.CreateDate.Format(time.RFC3339))
+	fmt.Printf("  Arn:         %s\n", item.OidcProvider.Arn)
+	fmt.Printf("  Url:         %s\n", item.OidcProvider.Url)
+	fmt.Printf("  Created:     %s\n", item.OidcProvider.CreateDate.Format(time.RFC3339))
 	fmt.Println("  Client Ids:")
-	for _, id := range oidcProvider.ClientIDs {
+	for _, id := range item.OidcProvider.ClientIDs {
 		fmt.Printf("    %s\n", id)
 	}
 	fmt.Println("  Thumbprints:")
-	for _, thumbprint := range oidcProvider.Thumbprints {
-		fmt.Printf("    %s\n", thumbprint)
+	for _, match := range item.OidcProvider.ThumbprintMatches {
+		switch {
+		case match.Subject == "":
+			fmt.Printf("    %s [not in issuer chain]\n", match.Thumbprint)
+		case match.Expired:
+			fmt.Printf("    %s %s [expired]\n", match.Thumbprint, match.Subject)
+		default:
+			fmt.Printf("    %s %s\n", match.Thumbprint, match.Subject)
+		}
+	}
+}
+
+func printOidcProviderMatches(item ClusterDetail) {
+	if len(item.DuplicateOidcProviders) != 0 {
+		fmt.Println("Duplicate OIDC Providers:")
+		for _, v := range item.DuplicateOidcProviders {
+			fmt.Printf("  %s\n", v)
+		}
+	}
+	if len(item.NearOidcProviders) != 0 {
+		fmt.Println("Similar OIDC Providers:")
+		for _, v := range item.NearOidcProviders {
+			fmt.Printf("  %s\n", v)
+		}
+	}
+}
+
+func printOidcDiscovery(discovery *OidcDiscoveryDetail) {
+	if discovery == nil {
+		return
+	}
+	fmt.Println("  Discovery:")
+	fmt.Printf("    Url:       %s\n", discovery.Url)
+	if discovery.Issuer != "" {
+		issuerFlag := ""
+		if !discovery.IssuerMatch {
+			issuerFlag = " [does not match cluster oidc issuer]"
+		}
+		fmt.Printf("    Issuer:    %s%s\n", discovery.Issuer, issuerFlag)
+		fmt.Printf("    Jwks Uri:  %s\n", discovery.JwksUri)
+		fmt.Printf("    Algs:      %s\n", strings.Join(discovery.SigningAlgValues, ", "))
+	}
+	if len(discovery.Keys) != 0 {
+		fmt.Println("    Keys:")
+		for _, key := range discovery.Keys {
+			fmt.Printf("      %s %s %s %s\n", key.Kid, key.Kty, key.Alg, key.Use)
+		}
+	}
+	if discovery.Error != "" {
+		fmt.Printf("    Error:     %s\n", discovery.Error)
+	}
+}
+
+func certificateFlags(certificate CertificateDetail) string {
+	var flags []string
+	if certificate.Expired {
+		flags = append(flags, "[expired]")
+	}
+	if certificate.InThumbprints {
+		flags = append(flags, "[provider thumbprint]")
+	}
+	if len(flags) == 0 {
+		return ""
 	}
+	return " " + strings.Join(flags, " ")
 }
@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	cmdDoctor = &cobra.Command{
+		Use:   "doctor <service-account>",
+		Short: "run IAM service account health check",
+		Long:  "",
+		Args:  cobra.ExactArgs(1),
+		Run:   runDoctorCmd,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(cmdDoctor)
+}
+
+const crossAccountHint = "set --cross-account-role template (e.g. arn:aws:iam::{account}:role/read-only) or --cross-account-config file with read only role in the role account"
+
+type CheckResult string
+
+const (
+	CheckPass CheckResult = "PASS"
+	CheckWarn CheckResult = "WARN"
+	CheckFail CheckResult = "FAIL"
+)
+
+type Check struct {
+	Name   string      `json:"name"`
+	Result CheckResult `json:"result"`
+	Detail string      `json:"detail"`
+	Hint   string      `json:"hint,omitempty"`
+}
+
+type Checks []Check
+
+func (c *Checks) Pass(name, detail string) {
+	*c = append(*c, Check{Name: name, Result: CheckPass, Detail: detail})
+}
+
+func (c *Checks) Warn(name, detail, hint string) {
+	*c = append(*c, Check{Name: name, Result: CheckWarn, Detail: detail, Hint: hint})
+}
+
+func (c *Checks) Fail(name, detail, hint string) {
+	*c = append(*c, Check{Name: name, Result: CheckFail, Detail: detail, Hint: hint})
+}
+
+func (c Checks) Failed() bool {
+	return slices.ContainsFunc(c, func(check Check) bool { return check.Result == CheckFail })
+}
+
+func runDoctorCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	associations := listPodIdentityAssociations(logger, awsClient, GlobalFlags.namespace)
+	sa, err := k8sClient.GetServiceAccount(GlobalFlags.namespace, args[0], associations)
+	if err != nil {
+		fmt.Printf("get service account %s/%s: %v\n", GlobalFlags.namespace, args[0], err)
+		os.Exit(1)
+	}
+
+	checks := runDoctorChecks(logger, awsClient, sa, GlobalFlags.EventsFilter())
+	report := DoctorReport{Namespace: sa.Namespace, Name: sa.Name, Failed: checks.Failed(), Checks: checks}
+	GlobalFlags.Output(logger).Print(KindDoctorReport, report, func() { printChecks(checks) })
+	if report.Failed {
+		os.Exit(1)
+	}
+}
+
+// runDoctorChecks runs ordered checklist, checks that depend on failed check are not run. IRSA checks are skipped if
+// the service account uses only EKS Pod Identity.
+func runDoctorChecks(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, filter aws.EventsFilter) Checks {
+	var checks Checks
+	if sa.Mechanism() == k8s.MechanismPodIdentity {
+		if checkPodIdentityRole(&checks, awsClient, sa) {
+			checkPodIdentityPods(&checks, sa)
+		}
+		return checks
+	}
+
+	cluster, ok := checkClusterOidcIssuer(&checks, awsClient)
+	if !ok {
+		return checks
+	}
+	checkOidcProvider(&checks, logger, awsClient, cluster, getTokenAudience(sa, ""))
+	if !checkRoleArn(&checks, sa) {
+		return checks
+	}
+	role, ok := checkRole(&checks, awsClient, sa)
+	if ok {
+		checkTrustPolicy(&checks, cluster, sa, role)
+	}
+	checkPods(&checks, sa)
+	state := aws.FailureState{RoleArn: sa.IamRoleArn, Identity: aws.NewWebIdentity(cluster, sa.Namespace, sa.Name, getTokenAudience(sa, ""))}
+	if ok {
+		state.RoleChecked, state.Role = true, &role
+	}
+	checkEvents(&checks, awsClient, sa, filter, state)
+
+	if sa.Mechanism() == k8s.MechanismBoth {
+		checks.Warn("mechanism", "service account has both IRSA annotation and EKS Pod Identity association",
+			"pods use credentials based on AWS SDK credential provider chain, remove one of the mechanisms when migration is finished")
+		if checkPodIdentityRole(&checks, awsClient, sa) {
+			checkPodIdentityPods(&checks, sa)
+		}
+	}
+	return checks
+}
+
+func checkClusterOidcIssuer(checks *Checks, awsClient aws.Client) (aws.Cluster, bool) {
+	name := "cluster oidc issuer"
+	cluster, err := awsClient.DescribeCluster()
+	if err != nil {
+		checks.Fail(name, fmt.Sprintf("describe cluster: %v", err), "verify cluster name and region in kubeconfig, and eks:DescribeCluster permission")
+		return aws.Cluster{}, false
+	}
+	if cluster.OidcIssuer == "" {
+		checks.Fail(name, fmt.Sprintf("cluster %s does not have oidc issuer", cluster.Name), "oidc issuer is available on EKS clusters 1.13 and later, upgrade the cluster")
+		return cluster, false
+	}
+	checks.Pass(name, cluster.OidcIssuer)
+	return cluster, true
+}
+
+func checkOidcProvider(checks *Checks, logger *slog.Logger, awsClient aws.Client, cluster aws.Cluster, audience string) {
+	provider, err := awsClient.GetClusterOidcProvider(cluster)
+	if err != nil {
+		checkOidcProviderError(checks, cluster, err)
+		return
+	}
+	fingerprint, err := cluster.OidcIssuerFingerprint()
+	if err != nil {
+		logger.Error(fmt.Sprintf("oidc cluster issuer fingerprint: %v", err))
+	}
+	checkOidcProviderConfig(checks, cluster, provider, []string{audience}, fingerprint, err)
+}
+
+func checkOidcProviderError(checks *Checks, cluster aws.Cluster, err error) {
+	name := "iam oidc provider"
+	var errNotFound *errs.ErrNotFound
+	if errors.As(err, &errNotFound) {
+		hint := fmt.Sprintf("create IAM OIDC provider e.g. 'eksctl utils associate-iam-oidc-provider --cluster %s --approve'", cluster.Name)
+		checks.Fail(name, fmt.Sprintf("oidc provider for %s not found", cluster.OidcIssuerHost()), hint)
+		return
+	}
+	checks.Fail(name, fmt.Sprintf("get oidc provider: %v", err), "verify iam:GetOpenIDConnectProvider permission")
+}
+
+// checkOidcProviderConfig validates IAM oidc provider against the cluster oidc issuer, audiences are token audiences
+// used by the service accounts and have to be in the provider client ids
+func checkOidcProviderConfig(checks *Checks, cluster aws.Cluster, provider aws.OidcProvider, audiences []string, fingerprint string, fingerprintErr error) {
+	name := "iam oidc provider"
+	if provider.Url != cluster.OidcIssuerHost() {
+		hint := fmt.Sprintf("create IAM OIDC provider e.g. 'eksctl utils associate-iam-oidc-provider --cluster %s --approve'", cluster.Name)
+		checks.Fail(name, fmt.Sprintf("provider url %s does not match issuer %s", provider.Url, cluster.OidcIssuerHost()), hint)
+	} else {
+		checks.Pass(name, provider.Arn)
+	}
+
+	name = "iam oidc provider account"
+	providerArn, providerErr := arn.Parse(provider.Arn)
+	clusterArn, clusterErr := arn.Parse(cluster.Arn)
+	switch {
+	case providerErr != nil || clusterErr != nil:
+		checks.Warn(name, fmt.Sprintf("cannot compare provider %s and cluster %s accounts", provider.Arn, cluster.Arn), "")
+	case providerArn.AccountID != clusterArn.AccountID:
+		checks.Fail(name, fmt.Sprintf("provider account %s does not match cluster account %s", providerArn.AccountID, clusterArn.AccountID),
+			"STS resolves the provider in the role account, use credentials for the cluster account (--profile or --assume-role flag)")
+	default:
+		checks.Pass(name, providerArn.AccountID)
+	}
+
+	name = "iam oidc provider client ids"
+	var missing []string
+	for _, audience := range audiences {
+		if !slices.Contains(provider.ClientIDs, audience) {
+			missing = append(missing, audience)
+		}
+	}
+	if len(missing) != 0 {
+		hint := fmt.Sprintf("add client id 'aws iam add-client-id-to-open-id-connect-provider --open-id-connect-provider-arn %s --client-id %s'", provider.Arn, missing[0])
+		checks.Fail(name, fmt.Sprintf("client ids %s do not contain %s", strings.Join(provider.ClientIDs, ", "), strings.Join(missing, ", ")), hint)
+	} else {
+		checks.Pass(name, strings.Join(audiences, ", "))
+	}
+
+	name = "iam oidc provider thumbprint"
+	if fingerprintErr != nil {
+		checks.Warn(name, fmt.Sprintf("oidc issuer fingerprint: %v", fingerprintErr), "verify network access to the oidc issuer")
+		return
+	}
+	if !slices.Contains(provider.Thumbprints, fingerprint) {
+		// IAM uses trusted root CAs for EKS oidc issuers, thumbprint mismatch is not fatal
+		hint := fmt.Sprintf("update thumbprint 'aws iam update-open-id-connect-provider-thumbprint --open-id-connect-provider-arn %s --thumbprint-list %s'", provider.Arn, fingerprint)
+		checks.Warn(name, fmt.Sprintf("thumbprints %s do not contain %s", strings.Join(provider.Thumbprints, ", "), fingerprint), hint)
+		return
+	}
+	checks.Pass(name, fingerprint)
+}
+
+func checkRoleArn(checks *Checks, sa k8s.ServiceAccount) bool {
+	name := "role arn annotation"
+	hint := fmt.Sprintf("annotate service account 'kubectl annotate -n %s serviceaccount %s eks.amazonaws.com/role-arn=arn:aws:iam::<account>:role/<name>'", sa.Namespace, sa.Name)
+	if err := aws.ValidateRoleArn(sa.IamRoleArn); err != nil {
+		checks.Fail(name, err.Error(), hint)
+		return false
+	}
+	checks.Pass(name, sa.IamRoleArn)
+	return true
+}
+
+func checkRole(checks *Checks, awsClient aws.Client, sa k8s.ServiceAccount) (aws.Role, bool) {
+	name := "iam role"
+	role, err := awsClient.GetIAMRole(sa.IamRoleArn)
+	if err != nil {
+		var errNotFound *errs.ErrNotFound
+		if errors.As(err, &errNotFound) {
+			checks.Fail(name, fmt.Sprintf("role %s not found", sa.RoleName()), "create the role or fix the service account annotation")
+			return aws.Role{}, false
+		}
+		var errForeignAccount *errs.ErrForeignAccount
+		if errors.As(err, &errForeignAccount) {
+			checks.Warn(name, err.Error(), crossAccountHint)
+			return aws.Role{}, false
+		}
+		checks.Fail(name, fmt.Sprintf("get role: %v", err), "verify iam:GetRole permission")
+		return aws.Role{}, false
+	}
+	if role.ARN != sa.IamRoleArn {
+		checks.Warn(name, fmt.Sprintf("found role %s, annotation is %s", role.ARN, sa.IamRoleArn), "role is in different account, verify the annotation")
+		return role, true
+	}
+	checks.Pass(name, role.ARN)
+	return role, true
+}
+
+func checkTrustPolicy(checks *Checks, cluster aws.Cluster, sa k8s.ServiceAccount, role aws.Role) {
+	checkWebIdentityTrust(checks, role, aws.NewWebIdentity(cluster, sa.Namespace, sa.Name, getTokenAudience(sa, "")))
+}
+
+func checkWebIdentityTrust(checks *Checks, role aws.Role, identity aws.WebIdentity) {
+	name := "trust policy"
+	verdict := aws.EvaluateTrustPolicy(role.AssumeRolePolicyDocument, identity)
+	if verdict.Allowed {
+		checks.Pass(name, fmt.Sprintf("statement %s allows %s", verdict.Statement, identity.Subject))
+		return
+	}
+
+	var failures []string
+	for _, failure := range verdict.Failures {
+		failures = append(failures, failure.String())
+	}
+	hint := fmt.Sprintf("allow %s with federated principal %s and sub %s", aws.ActionAssumeRoleWithWebIdentity, identity.ProviderArn, identity.Subject)
+	checks.Fail(name, strings.Join(failures, "; "), hint)
+}
+
+func checkPods(checks *Checks, sa k8s.ServiceAccount) {
+	name := "pods"
+	if len(sa.Pods) == 0 {
+		checks.Warn(name, "no pods use the service account", "nothing to verify, start a pod with the service account")
+		return
+	}
+
+	var notInjected, stale []string
+	for _, pod := range sa.Pods {
+		if !pod.Injected() {
+			notInjected = append(notInjected, pod.Name)
+			continue
+		}
+		if pod.RoleArnMismatch(sa.IamRoleArn) {
+			stale = append(stale, pod.Name)
+		}
+	}
+	if len(notInjected) != 0 {
+		hint := "pod identity webhook did not mutate the pods, verify the webhook is running and restart the pods"
+		checks.Fail(name, fmt.Sprintf("pods without injected env. variables and token volume: %s", strings.Join(notInjected, ", ")), hint)
+		return
+	}
+	if len(stale) != 0 {
+		checks.Fail(name, fmt.Sprintf("pods with injected role different from annotation: %s", strings.Join(stale, ", ")), "restart the pods")
+		return
+	}
+	checks.Pass(name, fmt.Sprintf("%d pod(s) have injected env. variables and token volume", len(sa.Pods)))
+}
+
+func checkPodIdentityRole(checks *Checks, awsClient aws.Client, sa k8s.ServiceAccount) bool {
+	name := "pod identity role"
+	if err := aws.ValidateRoleArn(sa.PodIdentityRoleArn); err != nil {
+		checks.Fail(name, fmt.Sprintf("association %s: %v", sa.PodIdentityAssociationId, err), "update the pod identity association role")
+		return false
+	}
+
+	role, err := awsClient.GetIAMRole(sa.PodIdentityRoleArn)
+	if err != nil {
+		var errNotFound *errs.ErrNotFound
+		if errors.As(err, &errNotFound) {
+			checks.Fail(name, fmt.Sprintf("role %s not found", sa.PodIdentityRoleArn), "create the role or update the pod identity association")
+			return false
+		}
+		var errForeignAccount *errs.ErrForeignAccount
+		if errors.As(err, &errForeignAccount) {
+			checks.Warn(name, err.Error(), crossAccountHint)
+			return false
+		}
+		checks.Fail(name, fmt.Sprintf("get role: %v", err), "verify iam:GetRole permission")
+		return false
+	}
+	checks.Pass(name, fmt.Sprintf("association %s role %s", sa.PodIdentityAssociationId, role.ARN))
+
+	name = "pod identity trust policy"
+	verdict := aws.EvaluatePodIdentityTrustPolicy(role.AssumeRolePolicyDocument)
+	if !verdict.Allowed {
+		var failures []string
+		for _, failure := range verdict.Failures {
+			failures = append(failures, failure.String())
+		}
+		hint := fmt.Sprintf("allow %s and %s for %s service principal", aws.ActionAssumeRole, aws.ActionTagSession, aws.PodIdentityServicePrincipal)
+		checks.Fail(name, strings.Join(failures, "; "), hint)
+		return true
+	}
+	checks.Pass(name, fmt.Sprintf("statement %s allows %s", verdict.Statement, aws.PodIdentityServicePrincipal))
+	return true
+}
+
+func checkPodIdentityPods(checks *Checks, sa k8s.ServiceAccount) {
+	name := "pod identity pods"
+	if len(sa.Pods) == 0 {
+		checks.Warn(name, "no pods use the service account", "nothing to verify, start a pod with the service account")
+		return
+	}
+
+	var notInjected []string
+	for _, pod := range sa.Pods {
+		if !pod.PodIdentityInjected() {
+			notInjected = append(notInjected, pod.Name)
+		}
+	}
+	if len(notInjected) != 0 {
+		hint := "verify eks-pod-identity-agent add-on is installed and restart the pods created before the association"
+		checks.Fail(name, fmt.Sprintf("pods without injected container credentials: %s", strings.Join(notInjected, ", ")), hint)
+		return
+	}
+	checks.Pass(name, fmt.Sprintf("%d pod(s) have injected container credentials", len(sa.Pods)))
+}
+
+// checkEvents checks latest AssumeRoleWithWebIdentity events, latest failed event is classified against the state
+func checkEvents(checks *Checks, awsClient aws.Client, sa k8s.ServiceAccount, filter aws.EventsFilter, state aws.FailureState) {
+	name := "assume role events"
+	events, err := awsClient.LookupEvents(sa.Namespace, sa.Name, filter)
+	if err != nil {
+		checks.Warn(name, fmt.Sprintf("lookup events: %v", err), "verify cloudtrail:LookupEvents permission")
+		return
+	}
+
+	events = events.WebIdentityEvents()
+	if len(events) == 0 {
+		checks.Warn(name, "no AssumeRoleWithWebIdentity events found", "pods have not assumed the role recently, check that the application uses AWS SDK with web identity support")
+		return
+	}
+
+	// events are returned latest first
+	failed := events.FailedEvents()
+	latest := events[0]
+	if latest.Failed() {
+		failure := aws.ClassifyFailure(latest, state)
+		detail := fmt.Sprintf("latest event at %s failed: %s %s (%d/%d failed), cause %s: %s", latest.EventTime.Format(time.RFC3339),
+			latest.ErrorCode, latest.ErrorMessage, len(failed), len(events), failure.Cause, failure.Detail)
+		checks.Fail(name, detail, fmt.Sprintf("%s, run 'kubectl-iam4sa get -n %s %s' to see failure summary", failure.Cause.Fix(), sa.Namespace, sa.Name))
+		return
+	}
+	if len(failed) != 0 {
+		checks.Warn(name, fmt.Sprintf("%d/%d events failed, latest event succeeded", len(failed), len(events)), "failures are possibly from pods that were restarted since")
+		return
+	}
+	checks.Pass(name, fmt.Sprintf("%d successful events", len(events)))
+}
+
+func printChecks(checks Checks) {
+	for _, check := range checks {
+		fmt.Printf("[%s] %s: %s\n", check.Result, check.Name, check.Detail)
+		if check.Hint != "" && check.Result != CheckPass {
+			fmt.Printf("       hint: %s\n", check.Hint)
+		}
+	}
+}
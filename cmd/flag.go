@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
 	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
 	"github.com/spf13/cobra"
 	"k8s.io/client-go/util/homedir"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var logLevels = map[string]slog.Level{"debug": slog.LevelDebug, "info": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
@@ -20,17 +25,83 @@ type Flags struct {
 	allNamespaces  bool
 	label          string
 	fieldSelector  string
+	output         string
+	since          time.Duration
+	start          string
+	end            string
+	eventNames     []string
+	eventSources   []string
+	eventsFrom     string
+	eventStore     string
+	concurrency    int
+	clusterName    string
+	region         string
+	profile        string
+	assumeRole     string
+	context        string
+	allContexts    bool
+	contexts       []string
+	crossAccount   string
+	crossConfig    string
 }
 
 func (f Flags) Kubeconfig() k8s.Kubeconfig {
-	kubeconfig, err := k8s.NewKubeconfig(f.kubeconfigPath)
+	kubeconfig, err := f.KubeconfigContext(f.context)
 	if err != nil {
-		fmt.Printf("load kubeconfig %s: %v", f.kubeconfigPath, err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
 	return kubeconfig
 }
 
+// KubeconfigContext returns kubeconfig for the context, current context if the context is empty
+func (f Flags) KubeconfigContext(context string) (k8s.Kubeconfig, error) {
+	overrides := k8s.Overrides{Context: context, ClusterName: f.clusterName, Region: f.region, Profile: f.profile, RoleArn: f.assumeRole}
+	kubeconfig, err := k8s.NewKubeconfig(f.kubeconfigPath, overrides)
+	if err != nil {
+		return k8s.Kubeconfig{}, fmt.Errorf("load kubeconfig %s: %v", f.kubeconfigPath, err)
+	}
+	return kubeconfig, nil
+}
+
+// Contexts returns kubeconfig contexts set by --all-contexts or --contexts flags, empty if the command should run only
+// in the --context (or current) context
+func (f Flags) Contexts() []string {
+	if !f.allContexts {
+		return f.contexts
+	}
+	contexts, err := k8s.ListContexts(f.kubeconfigPath)
+	if err != nil {
+		fmt.Printf("list kubeconfig %s contexts: %v\n", f.kubeconfigPath, err)
+		os.Exit(1)
+	}
+	return contexts
+}
+
+// CrossAccount returns cross account roles from --cross-account-config file (account id to role arn map) and
+// --cross-account-role template
+func (f Flags) CrossAccount() aws.CrossAccount {
+	if f.crossAccount != "" && !strings.Contains(f.crossAccount, aws.CrossAccountPlaceholder) {
+		fmt.Printf("invalid cross account role %s: missing %s placeholder\n", f.crossAccount, aws.CrossAccountPlaceholder)
+		os.Exit(1)
+	}
+	out := aws.CrossAccount{RoleTemplate: f.crossAccount}
+	if f.crossConfig == "" {
+		return out
+	}
+
+	b, err := os.ReadFile(f.crossConfig)
+	if err != nil {
+		fmt.Printf("read cross account config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := yaml.Unmarshal(b, &out.Roles); err != nil {
+		fmt.Printf("parse cross account config %s: %v\n", f.crossConfig, err)
+		os.Exit(1)
+	}
+	return out
+}
+
 func (f Flags) Logger() *slog.Logger {
 	if level, ok := logLevels[strings.ToLower(f.logLevel)]; ok {
 		opts := &slog.HandlerOptions{Level: level}
@@ -42,6 +113,74 @@ func (f Flags) Logger() *slog.Logger {
 	return nil
 }
 
+func (f Flags) Output(logger *slog.Logger) out.Output {
+	format, err := out.ParseFormat(f.output)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return out.NewOutput(logger, format)
+}
+
+// EventsFilter returns CloudTrail events filter, --start takes precedence over --since, --since window ends at --end
+// if only --end is set
+func (f Flags) EventsFilter() aws.EventsFilter {
+	now := time.Now()
+	filter := aws.EventsFilter{
+		EventNames:   f.eventNames,
+		EventSources: f.eventSources,
+	}
+
+	var start time.Time
+	if f.start != "" {
+		var err error
+		start, err = parseTime(f.start, now)
+		if err != nil {
+			fmt.Printf("invalid start %s: %v\n", f.start, err)
+			os.Exit(1)
+		}
+	}
+	if f.end != "" {
+		end, err := parseTime(f.end, now)
+		if err != nil {
+			fmt.Printf("invalid end %s: %v\n", f.end, err)
+			os.Exit(1)
+		}
+		filter.EndTime = end
+	}
+	filter.StartTime = aws.EventsStartTime(start, filter.EndTime, f.since, now)
+	if !filter.EndTime.IsZero() && !filter.StartTime.Before(filter.EndTime) {
+		fmt.Printf("invalid time window, start %s is not before end %s\n", filter.StartTime.Format(time.RFC3339), filter.EndTime.Format(time.RFC3339))
+		os.Exit(1)
+	}
+	return filter
+}
+
+// EventSource returns CloudTrail event source selected by --events-from flag, nil if events are looked up by API
+func (f Flags) EventSource(logger *slog.Logger) aws.EventSource {
+	if f.eventsFrom == "" {
+		return nil
+	}
+	if _, err := os.Stat(f.eventsFrom); err != nil {
+		fmt.Printf("invalid events from: %v\n", err)
+		os.Exit(1)
+	}
+	return aws.NewFileEventSource(logger, f.eventsFrom)
+}
+
+// EventStore returns CloudTrail Lake event data store arn set by --event-store flag
+func (f Flags) EventStore() string {
+	if f.eventStore != "" && f.eventsFrom != "" {
+		fmt.Println("--event-store and --events-from flags cannot be used together")
+		os.Exit(1)
+	}
+	return f.eventStore
+}
+
+func (f Flags) Concurrency() int {
+	return f.concurrency
+}
+
 func (f Flags) Namespace() string {
 	if f.allNamespaces {
 		return ""
@@ -104,6 +243,140 @@ func InitPersistentFlags(cmd *cobra.Command, flags *Flags) {
 		"",
 		"kubernetes field selector",
 	)
+	cmd.PersistentFlags().StringVarP(
+		&flags.output,
+		"output",
+		"o",
+		"text",
+		"output format - text, json, yaml",
+	)
+	cmd.PersistentFlags().DurationVar(
+		&flags.since,
+		"since",
+		aws.DefaultEventsWindow,
+		"cloudtrail events time window ending at end time, ignored if start is set",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.start,
+		"start",
+		"",
+		"cloudtrail events start time - RFC3339 or relative duration e.g. 72h, 3d",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.end,
+		"end",
+		"",
+		"cloudtrail events end time - RFC3339 or relative duration e.g. 24h, 1d (default now)",
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&flags.eventNames,
+		"event-name",
+		nil,
+		"cloudtrail event names e.g. AssumeRoleWithWebIdentity (default all)",
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&flags.eventSources,
+		"event-source",
+		nil,
+		"cloudtrail event sources e.g. sts.amazonaws.com (default all)",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.eventsFrom,
+		"events-from",
+		"",
+		"read cloudtrail events from local file or directory (S3 delivered log files, gzipped or not, or JSONL) instead of LookupEvents API",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.eventStore,
+		"event-store",
+		"",
+		"query cloudtrail events in cloudtrail lake event data store arn (e.g. organization trail, all regions) instead of LookupEvents API",
+	)
+	cmd.PersistentFlags().IntVar(
+		&flags.concurrency,
+		"concurrency",
+		4,
+		"number of concurrent AWS lookups, requests are rate limited to API limits",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.clusterName,
+		"cluster-name",
+		"",
+		"EKS cluster name, overrides cluster name resolved from kubeconfig",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.region,
+		"region",
+		"",
+		"AWS region, overrides region resolved from kubeconfig",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.profile,
+		"profile",
+		"",
+		"AWS profile, overrides profile resolved from kubeconfig",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.profile,
+		"aws-profile",
+		"",
+		"AWS profile used to load credentials, same as --profile",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.assumeRole,
+		"assume-role",
+		"",
+		"AWS role arn to assume with loaded credentials, overrides role resolved from kubeconfig",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.context,
+		"context",
+		"",
+		"kubeconfig context (default current context)",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&flags.allContexts,
+		"all-contexts",
+		false,
+		"run in all kubeconfig contexts (list command only)",
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&flags.contexts,
+		"contexts",
+		nil,
+		"run in supplied kubeconfig contexts e.g. a,b,c (list command only)",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.crossAccount,
+		"cross-account-role",
+		"",
+		"role arn template assumed to inspect roles in other accounts e.g. arn:aws:iam::{account}:role/read-only",
+	)
+	cmd.PersistentFlags().StringVar(
+		&flags.crossConfig,
+		"cross-account-config",
+		"",
+		"yaml or json file with account id to role arn map, assumed to inspect roles in other accounts",
+	)
+}
+
+// parseTime parses RFC3339 time, or duration relative to now (e.g. 36h, 2d means 36 hours and 2 days ago)
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		v, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expected RFC3339 time or relative duration")
+		}
+		return now.AddDate(0, 0, -v), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 time or relative duration")
+	}
+	return now.Add(-d), nil
 }
 
 func getStringEnv(envName string, defaultValue string) string {
@@ -2,13 +2,16 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/errs"
 	"github.com/pete911/kubectl-iam4sa/internal/k8s"
 	"github.com/pete911/kubectl-iam4sa/internal/out"
 	"github.com/spf13/cobra"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -21,7 +24,15 @@ var (
 	}
 )
 
+var getShowPolicies bool
+
 func init() {
+	cmdGet.Flags().BoolVar(
+		&getShowPolicies,
+		"show-policies",
+		false,
+		"show attached, inline and permissions boundary policies of the service account role",
+	)
 	RootCmd.AddCommand(cmdGet)
 }
 
@@ -36,71 +47,325 @@ func runGetCmd(_ *cobra.Command, args []string) {
 	}
 
 	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
-	awsClient, err := aws.NewClient(logger, kubeconfig.Region, kubeconfig.ClusterName)
+	awsClient, err := newAWSClient(logger, kubeconfig)
 	if err != nil {
 		fmt.Printf("aws client: %v\n", err)
 		os.Exit(1)
 	}
 
 	fieldSelector := GlobalFlags.FieldSelector(args)
-	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), fieldSelector)
+	associations := listPodIdentityAssociations(logger, awsClient, GlobalFlags.Namespace())
+	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), fieldSelector, associations)
 	if err != nil {
 		fmt.Printf("get IAM service accounts: %v\n", err)
 		os.Exit(1)
 	}
-	printGet(logger, awsClient, sas)
+	items := getServiceAccounts(logger, awsClient, sas, GlobalFlags.EventsFilter(), GlobalFlags.Concurrency(), getShowPolicies)
+	GlobalFlags.Output(logger).Print(KindServiceAccountDetailList, items, func() { printGet(logger, items) })
 }
 
-func printGet(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount) {
-	for _, sa := range sas {
-		printGetSa(logger, awsClient, sa)
+func getServiceAccounts(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount, filter aws.EventsFilter, concurrency int, showPolicies bool) []ServiceAccountDetail {
+	// cluster is needed only to validate trust policy, we can still print the rest if this fails
+	cluster, err := awsClient.DescribeCluster()
+	if err != nil {
+		logger.Error(fmt.Sprintf("describe cluster: %v", err))
 	}
+
+	items := make([]ServiceAccountDetail, len(sas))
+	runParallel(concurrency, len(sas), func(i int) {
+		items[i] = getServiceAccount(logger, awsClient, cluster, sas[i], filter, showPolicies)
+	})
+	return items
 }
 
-func printGetSa(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount) {
-	role, err := awsClient.GetIAMRole(sa.RoleName())
+func getServiceAccount(logger *slog.Logger, awsClient aws.Client, cluster aws.Cluster, sa k8s.ServiceAccount, filter aws.EventsFilter, showPolicies bool) ServiceAccountDetail {
+	events, err := awsClient.LookupEvents(sa.Namespace, sa.Name, filter)
 	if err != nil {
-		logger.Error(fmt.Sprintf("get role for %s/%s service account: %v", sa.Namespace, sa.Name, err))
+		logger.Error(fmt.Sprintf("lookup %s/%s event: %v", sa.Namespace, sa.Name, err))
+	}
+
+	item := ServiceAccountDetail{
+		Namespace:    sa.Namespace,
+		Name:         sa.Name,
+		Mechanism:    string(sa.Mechanism()),
+		RoleArn:      sa.IamRoleArn,
+		Pods:         toPodDetails(sa),
+		FailedEvents: toEventDetails(events.FailedEvents()),
 	}
 
-	events, err := awsClient.LookupEvents(sa.Namespace, sa.Name)
+	var role aws.Role
+	var roleErr error
+	if sa.IamRoleArn != "" {
+		role, roleErr = getIAMRole(logger, awsClient, sa, sa.IamRoleArn)
+		item.RoleError = errorMessage(roleErr)
+		item.Role = toRoleDetail(role)
+		if showPolicies {
+			setRolePolicies(logger, awsClient, sa, role, item.Role)
+		}
+		if role.ARN != "" && cluster.OidcIssuer != "" {
+			identity := aws.NewWebIdentity(cluster, sa.Namespace, sa.Name, getTokenAudience(sa, ""))
+			item.TrustPolicy = toTrustPolicy(aws.EvaluateTrustPolicy(role.AssumeRolePolicyDocument, identity))
+		}
+		if role.ARN != "" {
+			item.TrustRisks = toTrustRiskDetails(getTrustRisks(logger, role))
+		}
+		state := toFailureState(cluster, sa, role, roleErr)
+		item.FailureSummary = toFailureGroupDetails(aws.GroupFailures(events.WebIdentityEvents(), state))
+	}
+
+	if sa.PodIdentityRoleArn != "" {
+		// do not fetch the role again, if both mechanisms use the same role
+		podIdentityRole, roleError := role, item.RoleError
+		if sa.PodIdentityRoleArn != sa.IamRoleArn {
+			var err error
+			podIdentityRole, err = getIAMRole(logger, awsClient, sa, sa.PodIdentityRoleArn)
+			roleError = errorMessage(err)
+		}
+		item.PodIdentity = &PodIdentityDetail{
+			AssociationId: sa.PodIdentityAssociationId,
+			RoleArn:       sa.PodIdentityRoleArn,
+			Role:          toRoleDetail(podIdentityRole),
+			RoleError:     roleError,
+		}
+		if showPolicies {
+			setRolePolicies(logger, awsClient, sa, podIdentityRole, item.PodIdentity.Role)
+		}
+		if podIdentityRole.ARN != "" {
+			item.PodIdentity.TrustPolicy = toTrustPolicy(aws.EvaluatePodIdentityTrustPolicy(podIdentityRole.AssumeRolePolicyDocument))
+		}
+	}
+	return item
+}
+
+// toFailureState returns current IRSA role state, role is checked if it was fetched or if it does not exist
+func toFailureState(cluster aws.Cluster, sa k8s.ServiceAccount, role aws.Role, roleErr error) aws.FailureState {
+	var errNotFound *errs.ErrNotFound
+	state := aws.FailureState{
+		RoleArn:     sa.IamRoleArn,
+		RoleChecked: roleErr == nil || errors.As(roleErr, &errNotFound),
+		Identity:    aws.NewWebIdentity(cluster, sa.Namespace, sa.Name, getTokenAudience(sa, "")),
+	}
+	if role.ARN != "" {
+		state.Role = &role
+	}
+	return state
+}
+
+// getTrustRisks returns IRSA role trust policy risks, policy parse errors are only logged
+func getTrustRisks(logger *slog.Logger, role aws.Role) []aws.TrustRisk {
+	risks, err := aws.TrustPolicyRisks(role.AssumeRolePolicyDocument)
 	if err != nil {
-		logger.Error(fmt.Sprintf("lookup %s/%s event: %v", sa.Namespace, sa.Name, err))
+		logger.Error(fmt.Sprintf("role %s trust policy risks: %v", role.ARN, err))
 	}
-	failedEvents := events.FailedEvents()
+	return risks
+}
+
+// getIAMRole returns role and logged error if the role could not be fetched, roles in foreign accounts (without cross
+// account role) are only logged as warning
+func getIAMRole(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, roleArn string) (aws.Role, error) {
+	role, err := awsClient.GetIAMRole(roleArn)
+	if err != nil {
+		var errForeignAccount *errs.ErrForeignAccount
+		if errors.As(err, &errForeignAccount) {
+			logger.Warn(fmt.Sprintf("%s/%s service account: %v", sa.Namespace, sa.Name, err))
+		} else {
+			logger.Error(fmt.Sprintf("get role for %s/%s service account: %v", sa.Namespace, sa.Name, err))
+		}
+		return role, err
+	}
+	return role, nil
+}
 
-	printSA(sa)
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
 
-	fmt.Println()
-	printRole(logger, sa, role)
+// setRolePolicies sets role detail policies, nothing is set if the role was not found
+func setRolePolicies(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, role aws.Role, detail *RoleDetail) {
+	if detail == nil {
+		return
+	}
+	policies, err := awsClient.GetIAMRolePolicies(role)
+	if err != nil {
+		logger.Error(fmt.Sprintf("get role policies for %s/%s service account: %v", sa.Namespace, sa.Name, err))
+		return
+	}
+	detail.Policies = toRolePolicies(policies)
+}
+
+func printGet(logger *slog.Logger, items []ServiceAccountDetail) {
+	for _, item := range items {
+		printGetSa(logger, item)
+	}
+}
+
+func printGetSa(logger *slog.Logger, item ServiceAccountDetail) {
+	printSA(item)
+
+	if item.RoleArn != "" {
+		fmt.Println()
+		printRole(logger, item)
+		printTrustPolicy("Trust Policy", item.TrustPolicy)
+		printTrustRisks(item.TrustRisks)
+		if item.Role != nil {
+			printPolicies(logger, item.Role.Policies)
+		}
+	}
+	if item.PodIdentity != nil {
+		fmt.Println()
+		printPodIdentity(logger, *item.PodIdentity)
+	}
 
+	if len(item.FailureSummary) != 0 {
+		fmt.Println()
+		printFailureSummary(item.FailureSummary)
+	}
 	// if there are any failed events, lets print them
-	if len(failedEvents) != 0 {
+	if len(item.FailedEvents) != 0 {
 		fmt.Println()
 		fmt.Println("Failed Events:")
-		printEvents(logger, sa, failedEvents)
+		printEvents(logger, item.RoleArn, item.FailedEvents)
 	}
 }
 
-func printSA(sa k8s.ServiceAccount) {
-	fmt.Printf("Name:      %s\n", sa.Name)
-	fmt.Printf("Namespace: %s\n", sa.Namespace)
+func printSA(item ServiceAccountDetail) {
+	fmt.Printf("Name:      %s\n", item.Name)
+	fmt.Printf("Namespace: %s\n", item.Namespace)
+	fmt.Printf("Mechanism: %s\n", item.Mechanism)
 	fmt.Println("Pods:")
-	for _, pod := range sa.Pods {
-		fmt.Printf("  %s\n", pod)
+	for _, pod := range item.Pods {
+		printPod(item, pod)
+	}
+}
+
+func printPod(item ServiceAccountDetail, pod PodDetail) {
+	fmt.Printf("  %s (%s, created %s)\n", pod.Name, pod.Phase, pod.CreatedAt.Format(time.RFC3339))
+	for _, container := range pod.Containers {
+		name := container.Name
+		if container.Init {
+			name = fmt.Sprintf("%s (init)", name)
+		}
+		if container.Skipped {
+			name = fmt.Sprintf("%s (skipped)", name)
+		}
+		fmt.Printf("    Container: %s\n", name)
+		fmt.Printf("      AWS_ROLE_ARN:                %s\n", valueOrNotSet(container.RoleArn))
+		fmt.Printf("      AWS_WEB_IDENTITY_TOKEN_FILE: %s\n", valueOrNotSet(container.WebIdentityTokenFile))
+		fmt.Printf("      AWS_STS_REGIONAL_ENDPOINTS:  %s\n", valueOrNotSet(container.StsRegionalEndpoints))
+		fmt.Printf("      AWS_REGION:                  %s\n", valueOrNotSet(container.Region))
+		if container.ContainerCredentialsFullUri != "" {
+			fmt.Printf("      AWS_CONTAINER_CREDENTIALS_FULL_URI: %s\n", container.ContainerCredentialsFullUri)
+		}
+	}
+	if pod.TokenVolume {
+		fmt.Printf("    Token Volume: audience %s, expiration %ds\n", pod.TokenAudience, pod.TokenExpirationSeconds)
+	} else if item.RoleArn != "" {
+		fmt.Println("    Token Volume: not set, pod was not mutated by pod identity webhook, restart the pod")
+	}
+	if pod.RoleArnMismatch {
+		fmt.Printf("    Role Mismatch: injected role %s differs from annotation %s, restart the pod\n", pod.RoleArn, item.RoleArn)
+	}
+}
+
+func roleErrorOrNotFound(roleError string) string {
+	if roleError == "" {
+		return "not found"
+	}
+	return roleError
+}
+
+func valueOrNotSet(v string) string {
+	if v == "" {
+		return "<not set>"
+	}
+	return v
+}
+
+func printRole(logger *slog.Logger, item ServiceAccountDetail) {
+	fmt.Printf("Service Account Role: %s\n", item.RoleArn)
+	if item.Role == nil {
+		fmt.Printf("AWS Role Policy Document: %s\n", roleErrorOrNotFound(item.RoleError))
+		return
+	}
+	jsonPrettyPrint(logger, string(item.Role.AssumeRolePolicyDocument))
+}
+
+func printPodIdentity(logger *slog.Logger, podIdentity PodIdentityDetail) {
+	fmt.Printf("Pod Identity Association: %s\n", podIdentity.AssociationId)
+	fmt.Printf("Pod Identity Role: %s\n", podIdentity.RoleArn)
+	if podIdentity.Role == nil {
+		fmt.Printf("AWS Role Policy Document: %s\n", roleErrorOrNotFound(podIdentity.RoleError))
+		return
+	}
+	jsonPrettyPrint(logger, string(podIdentity.Role.AssumeRolePolicyDocument))
+	printTrustPolicy("Pod Identity Trust Policy", podIdentity.TrustPolicy)
+	printPolicies(logger, podIdentity.Role.Policies)
+}
+
+// printPolicies prints permission policies of the role, nothing is printed if the policies were not requested
+func printPolicies(logger *slog.Logger, policies *RolePolicies) {
+	if policies == nil {
+		return
+	}
+	if policies.PermissionsBoundary != nil {
+		fmt.Printf("Permissions Boundary: %s (%s)\n", policies.PermissionsBoundary.Arn, policies.PermissionsBoundary.VersionId)
+		jsonPrettyPrint(logger, string(policies.PermissionsBoundary.Document))
+	}
+	if len(policies.Attached) == 0 && len(policies.Inline) == 0 {
+		fmt.Println("Policies: none")
+		return
+	}
+	for _, policy := range policies.Attached {
+		fmt.Printf("Attached Policy: %s (%s)\n", policy.Arn, policy.VersionId)
+		jsonPrettyPrint(logger, string(policy.Document))
+	}
+	for _, policy := range policies.Inline {
+		fmt.Printf("Inline Policy: %s\n", policy.Name)
+		jsonPrettyPrint(logger, string(policy.Document))
 	}
 }
 
-func printRole(logger *slog.Logger, sa k8s.ServiceAccount, role aws.Role) {
-	fmt.Printf("Service Account Role: %s\n", sa.IamRoleArn)
-	if role.ARN == "" {
-		fmt.Println("AWS Role Policy Document: not found")
+func printTrustPolicy(title string, trustPolicy *TrustPolicy) {
+	if trustPolicy == nil {
 		return
 	}
-	jsonPrettyPrint(logger, role.AssumeRolePolicyDocument)
+	if trustPolicy.Allowed {
+		fmt.Printf("%s: PASS (statement %s)\n", title, trustPolicy.Statement)
+		return
+	}
+	fmt.Printf("%s: FAIL\n", title)
+	for _, failure := range trustPolicy.Failures {
+		fmt.Printf("  %s\n", failure)
+	}
+}
+
+func printTrustRisks(risks []TrustRiskDetail) {
+	if len(risks) == 0 {
+		return
+	}
+	fmt.Println("Trust Policy Risks:")
+	for _, risk := range risks {
+		if risk.Statement == "" {
+			fmt.Printf("  [%s] %s: %s\n", strings.ToUpper(risk.Severity), risk.Check, risk.Message)
+			continue
+		}
+		fmt.Printf("  [%s] statement %s: %s: %s\n", strings.ToUpper(risk.Severity), risk.Statement, risk.Check, risk.Message)
+	}
+}
+
+func printFailureSummary(groups []FailureGroupDetail) {
+	fmt.Println("Failure Summary:")
+	for _, group := range groups {
+		fmt.Printf("  %s: %d failed, latest %s\n", group.Cause, group.Count, group.Latest.Format(time.RFC3339))
+		fmt.Printf("    detail: %s\n", group.Detail)
+		fmt.Printf("    fix:    %s\n", group.Fix)
+	}
 }
 
-func printEvents(logger *slog.Logger, sa k8s.ServiceAccount, events []aws.Event) {
+func printEvents(logger *slog.Logger, saRoleArn string, events []EventDetail) {
 	table := out.NewTable(logger)
 	table.AddRow("TIME", "CODE", "MESSAGE", "REQUEST ROLE", "SA ROLE")
 	for i, event := range events {
@@ -108,7 +373,7 @@ func printEvents(logger *slog.Logger, sa k8s.ServiceAccount, events []aws.Event)
 		if i == 5 {
 			break
 		}
-		table.AddRow(event.EventTime.Format(time.RFC3339), event.ErrorCode, event.ErrorMessage, event.RequestParameters.RoleArn, sa.IamRoleArn)
+		table.AddRow(event.EventTime.Format(time.RFC3339), event.ErrorCode, event.ErrorMessage, event.RequestRoleArn, saRoleArn)
 	}
 	table.Print()
 }
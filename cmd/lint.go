@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	cmdLint = &cobra.Command{
+		Use:   "lint [service-account...]",
+		Short: "report over-permissive IRSA role trust policies, exits with non-zero code if any risk is found",
+		Long:  "",
+		Run:   runLintCmd,
+	}
+)
+
+var lintSeverity string
+
+func init() {
+	cmdLint.Flags().StringVar(
+		&lintSeverity,
+		"severity",
+		string(aws.SeverityMedium),
+		"minimum reported risk severity (low, medium, high)",
+	)
+	RootCmd.AddCommand(cmdLint)
+}
+
+func runLintCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+
+	severity, err := aws.ParseSeverity(lintSeverity)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	fieldSelector := GlobalFlags.FieldSelector(args)
+	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), fieldSelector, nil)
+	if err != nil {
+		fmt.Printf("list IAM service accounts: %v\n", err)
+		os.Exit(1)
+	}
+
+	findings := lintServiceAccounts(logger, awsClient, sas, severity, GlobalFlags.Concurrency())
+	report := LintReport{Severity: string(severity), Failed: len(findings) != 0, Findings: findings}
+	GlobalFlags.Output(logger).Print(KindLintReport, report, func() { printLint(logger, report) })
+	if report.Failed {
+		os.Exit(1)
+	}
+}
+
+// lintSeverityError is severity of findings for roles that could not be evaluated (e.g. access denied or invalid
+// trust policy), these are always reported, so lint does not pass silently
+const lintSeverityError = "error"
+
+// lintServiceAccounts returns trust policy risks of IRSA roles with at least the supplied severity, roles shared by
+// multiple service accounts are fetched once, and findings are sorted by severity (errors and highest first)
+func lintServiceAccounts(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount, severity aws.Severity, concurrency int) []LintFinding {
+	var mu sync.Mutex
+	roleRisks := make(map[string][]aws.TrustRisk)
+	roleErrs := make(map[string]error)
+	sas = slices.DeleteFunc(sas, func(sa k8s.ServiceAccount) bool { return sa.IamRoleArn == "" })
+	runParallel(concurrency, len(sas), func(i int) {
+		mu.Lock()
+		_, ok := roleRisks[sas[i].IamRoleArn]
+		if !ok {
+			roleRisks[sas[i].IamRoleArn] = nil
+		}
+		mu.Unlock()
+		if ok {
+			return
+		}
+
+		role, err := getIAMRole(logger, awsClient, sas[i], sas[i].IamRoleArn)
+		var risks []aws.TrustRisk
+		if err == nil {
+			if risks, err = aws.TrustPolicyRisks(role.AssumeRolePolicyDocument); err != nil {
+				err = fmt.Errorf("trust policy: %w", err)
+			}
+		}
+		mu.Lock()
+		roleRisks[sas[i].IamRoleArn] = risks
+		if err != nil {
+			roleErrs[sas[i].IamRoleArn] = err
+		}
+		mu.Unlock()
+	})
+
+	findings := make([]LintFinding, 0)
+	for _, sa := range sas {
+		if err, ok := roleErrs[sa.IamRoleArn]; ok {
+			findings = append(findings, LintFinding{
+				Severity:       lintSeverityError,
+				Namespace:      sa.Namespace,
+				ServiceAccount: sa.Name,
+				RoleArn:        sa.IamRoleArn,
+				Check:          "evaluation",
+				Message:        fmt.Sprintf("role could not be evaluated: %v", err),
+			})
+			continue
+		}
+		for _, risk := range roleRisks[sa.IamRoleArn] {
+			if !risk.Severity.AtLeast(severity) {
+				continue
+			}
+			findings = append(findings, LintFinding{
+				Severity:       string(risk.Severity),
+				Namespace:      sa.Namespace,
+				ServiceAccount: sa.Name,
+				RoleArn:        sa.IamRoleArn,
+				Statement:      risk.Statement,
+				Check:          string(risk.Check),
+				Message:        risk.Message,
+			})
+		}
+	}
+	slices.SortStableFunc(findings, func(a, b LintFinding) int {
+		if aError, bError := a.Severity == lintSeverityError, b.Severity == lintSeverityError; aError != bError {
+			if aError {
+				return -1
+			}
+			return 1
+		}
+		aSeverity, bSeverity := aws.Severity(a.Severity), aws.Severity(b.Severity)
+		if aSeverity != bSeverity {
+			if aSeverity.AtLeast(bSeverity) {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.ServiceAccount, b.ServiceAccount))
+	})
+	return findings
+}
+
+func printLint(logger *slog.Logger, report LintReport) {
+	if len(report.Findings) == 0 {
+		fmt.Printf("no trust policy risks with %s or higher severity\n", report.Severity)
+		return
+	}
+	table := out.NewTable(logger)
+	table.AddRow("SEVERITY", "NAMESPACE", "SERVICE ACCOUNT", "IAM ROLE", "STATEMENT", "CHECK", "MESSAGE")
+	for _, finding := range report.Findings {
+		table.AddRow(strings.ToUpper(finding.Severity), finding.Namespace, finding.ServiceAccount, finding.RoleArn,
+			finding.Statement, finding.Check, finding.Message)
+	}
+	table.Print()
+}
@@ -19,49 +19,177 @@ var (
 	}
 )
 
+var listBulkEvents bool
+
 func init() {
+	cmdList.Flags().BoolVar(
+		&listBulkEvents,
+		"bulk-events",
+		false,
+		"lookup all AssumeRoleWithWebIdentity events once and group them by service account, instead of lookup per service account (always set with --event-store)",
+	)
 	RootCmd.AddCommand(cmdList)
 }
 
 func runListCmd(_ *cobra.Command, args []string) {
 	logger := GlobalFlags.Logger()
-	kubeconfig := GlobalFlags.Kubeconfig()
+	if contexts := GlobalFlags.Contexts(); len(contexts) != 0 {
+		if GlobalFlags.clusterName != "" {
+			fmt.Println("--cluster-name flag cannot be used with multiple contexts")
+			os.Exit(1)
+		}
+		items := listContexts(logger, contexts, args)
+		GlobalFlags.Output(logger).Print(KindServiceAccountList, items, func() { printListTable(logger, items, true) })
+		return
+	}
 
-	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	items, err := listContext(logger, GlobalFlags.Kubeconfig(), args)
 	if err != nil {
-		fmt.Printf("k8s client: %v\n", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	GlobalFlags.Output(logger).Print(KindServiceAccountList, items, func() { printListTable(logger, items, false) })
+}
+
+// listContexts lists service accounts in kubeconfig contexts concurrently, contexts that fail are logged and skipped
+func listContexts(logger *slog.Logger, contexts []string, args []string) []ServiceAccountSummary {
+	results := make([][]ServiceAccountSummary, len(contexts))
+	runParallel(GlobalFlags.Concurrency(), len(contexts), func(i int) {
+		kubeconfig, err := GlobalFlags.KubeconfigContext(contexts[i])
+		if err != nil {
+			logger.Error(fmt.Sprintf("context %s: %v", contexts[i], err))
+			return
+		}
+		items, err := listContext(logger.With("context", contexts[i]), kubeconfig, args)
+		if err != nil {
+			logger.Error(fmt.Sprintf("context %s: %v", contexts[i], err))
+			return
+		}
+		results[i] = items
+	})
+
+	items := make([]ServiceAccountSummary, 0)
+	for _, result := range results {
+		items = append(items, result...)
+	}
+	return items
+}
+
+// listContext lists service accounts in the kubeconfig context, items have cluster set to EKS cluster name
+func listContext(logger *slog.Logger, kubeconfig k8s.Kubeconfig, args []string) ([]ServiceAccountSummary, error) {
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("k8s client: %v", err)
+	}
 
 	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
-	awsClient, err := aws.NewClient(logger, kubeconfig.Region, kubeconfig.ClusterName)
+	awsClient, err := newAWSClient(logger, kubeconfig)
 	if err != nil {
-		fmt.Printf("aws client: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("aws client: %v", err)
 	}
 
 	fieldSelector := GlobalFlags.FieldSelector(args)
-	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), fieldSelector)
+	associations := listPodIdentityAssociations(logger, awsClient, GlobalFlags.Namespace())
+	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), fieldSelector, associations)
 	if err != nil {
-		fmt.Printf("list IAM service accounts: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("list IAM service accounts: %v", err)
+	}
+	var items []ServiceAccountSummary
+	// each event store query is billed by scanned data, all service accounts are looked up in one query
+	if listBulkEvents || GlobalFlags.EventStore() != "" {
+		items = listServiceAccountsBulk(logger, awsClient, sas, GlobalFlags.EventsFilter())
+	} else {
+		items = listServiceAccounts(logger, awsClient, sas, GlobalFlags.EventsFilter(), GlobalFlags.Concurrency())
 	}
-	printListTable(logger, awsClient, sas)
+	setRisks(logger, awsClient, sas, items, GlobalFlags.Concurrency())
+	for i := range items {
+		items[i].Cluster = awsClient.ClusterName()
+		items[i].ForeignRole = items[i].RoleAccount != "" && items[i].RoleAccount != awsClient.Account()
+	}
+	return items, nil
 }
 
-func printListTable(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount) {
-	table := out.NewTable(logger)
-	table.AddRow("NAMESPACE", "SERVICE ACCOUNT", "PODS", "IAM ROLE ACCOUNT", "IAM ROLE", "EVENTS", "FAILED")
-	for _, sa := range sas {
-		events, err := awsClient.LookupEvents(sa.Namespace, sa.Name)
+// setRisks sets the highest IRSA role trust policy risk severity on items, items have the same order as service
+// accounts
+func setRisks(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount, items []ServiceAccountSummary, concurrency int) {
+	runParallel(concurrency, len(sas), func(i int) {
+		if sas[i].IamRoleArn == "" {
+			return
+		}
+		role, _ := getIAMRole(logger, awsClient, sas[i], sas[i].IamRoleArn)
+		if role.ARN == "" {
+			return
+		}
+		items[i].Risk = string(aws.MaxSeverity(getTrustRisks(logger, role)))
+	})
+}
+
+// listPodIdentityAssociations returns EKS Pod Identity associations, errors are only logged (e.g. missing permissions)
+// so the IRSA service accounts can still be listed
+func listPodIdentityAssociations(logger *slog.Logger, awsClient aws.Client, namespace string) []aws.PodIdentityAssociation {
+	associations, err := awsClient.ListPodIdentityAssociations(namespace)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("list pod identity associations: %v", err))
+		return nil
+	}
+	return associations
+}
+
+// listServiceAccounts looks up events for service accounts concurrently, output has the same order as service accounts.
+// Only AssumeRoleWithWebIdentity events are counted, the same events as in listServiceAccountsBulk.
+func listServiceAccounts(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount, filter aws.EventsFilter, concurrency int) []ServiceAccountSummary {
+	items := make([]ServiceAccountSummary, len(sas))
+	runParallel(concurrency, len(sas), func(i int) {
+		sa := sas[i]
+		events, err := awsClient.LookupEvents(sa.Namespace, sa.Name, filter)
 		if err != nil {
 			logger.Error(fmt.Sprintf("lookup %s/%s event: %v", sa.Namespace, sa.Name, err))
 		}
+		items[i] = toServiceAccountSummary(sa, events.WebIdentityEvents())
+	})
+	return items
+}
+
+// listServiceAccountsBulk looks up all AssumeRoleWithWebIdentity events once and groups them by service account
+func listServiceAccountsBulk(logger *slog.Logger, awsClient aws.Client, sas []k8s.ServiceAccount, filter aws.EventsFilter) []ServiceAccountSummary {
+	events, err := awsClient.LookupWebIdentityEvents(filter)
+	if err != nil {
+		logger.Error(fmt.Sprintf("lookup web identity events: %v", err))
+	}
+
+	items := make([]ServiceAccountSummary, 0, len(sas))
+	for _, sa := range sas {
+		username := fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+		items = append(items, toServiceAccountSummary(sa, events[username]))
+	}
+	return items
+}
 
-		numPods := fmt.Sprintf("%d", len(sa.Pods))
-		numEvents := fmt.Sprintf("%d", len(events))
-		numFailedEvents := fmt.Sprintf("%d", len(events.FailedEvents()))
-		table.AddRow(sa.Namespace, sa.Name, numPods, sa.RoleAccount(), sa.RoleName(), numEvents, numFailedEvents)
+// printListTable prints cluster column only if the items are from multiple clusters (contexts)
+func printListTable(logger *slog.Logger, items []ServiceAccountSummary, withCluster bool) {
+	table := out.NewTable(logger)
+	header := []string{"NAMESPACE", "SERVICE ACCOUNT", "MECHANISM", "PODS", "IAM ROLE ACCOUNT", "IAM ROLE", "RISK", "EVENTS", "FAILED"}
+	if withCluster {
+		header = append([]string{"CLUSTER"}, header...)
+	}
+	table.AddRow(header...)
+	for _, item := range items {
+		numPods := fmt.Sprintf("%d", item.Pods)
+		numEvents := fmt.Sprintf("%d", item.Events)
+		numFailedEvents := fmt.Sprintf("%d", item.FailedEvents)
+		roleAccount := item.RoleAccount
+		if item.ForeignRole {
+			roleAccount = fmt.Sprintf("%s (foreign)", roleAccount)
+		}
+		risk := item.Risk
+		if risk == "" {
+			risk = "-"
+		}
+		row := []string{item.Namespace, item.Name, item.Mechanism, numPods, roleAccount, item.RoleName, risk, numEvents, numFailedEvents}
+		if withCluster {
+			row = append([]string{item.Cluster}, row...)
+		}
+		table.AddRow(row...)
 	}
 	table.Print()
 }
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"sync"
+)
+
+// runParallel calls fn for each index in [0, n) with at most concurrency goroutines. Results should be stored by
+// index, so the output order is deterministic.
+func runParallel(concurrency, n int, fn func(i int)) {
+	concurrency = max(1, min(concurrency, n))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for i := range indexes {
+				fn(i)
+			}
+		})
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,751 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"slices"
+	"strings"
+	"time"
+)
+
+// machine readable output (json, yaml) schema, changes have to be backward compatible (adding fields is fine),
+// breaking changes require new out.APIVersion
+
+const (
+	KindServiceAccountList       = "ServiceAccountList"
+	KindServiceAccountDetailList = "ServiceAccountDetailList"
+	KindCluster                  = "Cluster"
+	KindDoctorReport             = "DoctorReport"
+	KindStaleReport              = "StaleReport"
+	KindCanIReport               = "CanIReport"
+	KindTokenReport              = "TokenReport"
+	KindAuditReport              = "AuditReport"
+	KindLintReport               = "LintReport"
+	KindActivityReport           = "ActivityReport"
+	KindSuggestPolicyReport      = "SuggestPolicyReport"
+)
+
+type ServiceAccountSummary struct {
+	Cluster      string `json:"cluster"`
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	Mechanism    string `json:"mechanism"`
+	Pods         int    `json:"pods"`
+	RoleArn      string `json:"roleArn"`
+	RoleAccount  string `json:"roleAccount"`
+	ForeignRole  bool   `json:"foreignRole"` // role is in different account than the AWS caller
+	RoleName     string `json:"roleName"`
+	Events       int    `json:"events"`
+	FailedEvents int    `json:"failedEvents"`
+	Risk         string `json:"risk"` // highest IRSA role trust policy risk severity, empty if there are no risks
+}
+
+type ServiceAccountDetail struct {
+	Namespace    string             `json:"namespace"`
+	Name         string             `json:"name"`
+	Mechanism    string             `json:"mechanism"`
+	RoleArn      string             `json:"roleArn"`
+	Pods         []PodDetail        `json:"pods"`
+	Role         *RoleDetail        `json:"role"`
+	RoleError    string             `json:"roleError,omitempty"`
+	TrustPolicy  *TrustPolicy       `json:"trustPolicy"`
+	TrustRisks   []TrustRiskDetail  `json:"trustRisks"`
+	PodIdentity  *PodIdentityDetail `json:"podIdentity"`
+	FailedEvents []EventDetail      `json:"failedEvents"`
+	// FailureSummary is failed AssumeRoleWithWebIdentity events grouped by cause
+	FailureSummary []FailureGroupDetail `json:"failureSummary"`
+}
+
+type FailureGroupDetail struct {
+	Cause  string    `json:"cause"`
+	Count  int       `json:"count"`
+	Latest time.Time `json:"latest"`
+	Detail string    `json:"detail"`
+	Fix    string    `json:"fix"`
+}
+
+// PodIdentityDetail is EKS Pod Identity association, Role and TrustPolicy are the same as in ServiceAccountDetail, but
+// for the association role
+type PodIdentityDetail struct {
+	AssociationId string       `json:"associationId"`
+	RoleArn       string       `json:"roleArn"`
+	Role          *RoleDetail  `json:"role"`
+	RoleError     string       `json:"roleError,omitempty"`
+	TrustPolicy   *TrustPolicy `json:"trustPolicy"`
+}
+
+// PodDetail RoleArn, WebIdentityTokenFile and ContainerCredentialsFullUri are from the first container that has them set
+type PodDetail struct {
+	Name                        string            `json:"name"`
+	CreatedAt                   time.Time         `json:"createdAt"`
+	Phase                       string            `json:"phase"`
+	RoleArn                     string            `json:"roleArn"`
+	RoleArnMismatch             bool              `json:"roleArnMismatch"`
+	WebIdentityTokenFile        string            `json:"webIdentityTokenFile"`
+	TokenVolume                 bool              `json:"tokenVolume"`
+	TokenAudience               string            `json:"tokenAudience"`
+	TokenExpirationSeconds      int64             `json:"tokenExpirationSeconds"`
+	ContainerCredentialsFullUri string            `json:"containerCredentialsFullUri"`
+	Containers                  []ContainerDetail `json:"containers"`
+}
+
+type ContainerDetail struct {
+	Name                        string `json:"name"`
+	Init                        bool   `json:"init"`
+	Skipped                     bool   `json:"skipped"`
+	RoleArn                     string `json:"roleArn"`
+	WebIdentityTokenFile        string `json:"webIdentityTokenFile"`
+	StsRegionalEndpoints        string `json:"stsRegionalEndpoints"`
+	Region                      string `json:"region"`
+	ContainerCredentialsFullUri string `json:"containerCredentialsFullUri"`
+	TokenVolumeMounted          bool   `json:"tokenVolumeMounted"`
+}
+
+type RoleDetail struct {
+	Arn                      string          `json:"arn"`
+	Name                     string          `json:"name"`
+	Description              string          `json:"description"`
+	CreateDate               time.Time       `json:"createDate"`
+	RoleLastUsed             time.Time       `json:"roleLastUsed"`
+	AssumeRolePolicyDocument json.RawMessage `json:"assumeRolePolicyDocument"`
+	PermissionsBoundaryArn   string          `json:"permissionsBoundaryArn,omitempty"`
+	Policies                 *RolePolicies   `json:"policies,omitempty"` // set only with --show-policies flag
+}
+
+type RolePolicies struct {
+	Attached            []PolicyDetail `json:"attached"`
+	Inline              []PolicyDetail `json:"inline"`
+	PermissionsBoundary *PolicyDetail  `json:"permissionsBoundary"`
+}
+
+// PolicyDetail Arn and VersionId are empty for inline policies
+type PolicyDetail struct {
+	Name      string          `json:"name"`
+	Arn       string          `json:"arn,omitempty"`
+	VersionId string          `json:"versionId,omitempty"`
+	Document  json.RawMessage `json:"document"`
+}
+
+type TrustPolicy struct {
+	Allowed   bool                 `json:"allowed"`
+	Statement string               `json:"statement,omitempty"`
+	Failures  []TrustPolicyFailure `json:"failures"`
+}
+
+type TrustRiskDetail struct {
+	Severity  string `json:"severity"`
+	Check     string `json:"check"`
+	Statement string `json:"statement,omitempty"`
+	Message   string `json:"message"`
+}
+
+type TrustPolicyFailure struct {
+	Statement string `json:"statement"`
+	Check     string `json:"check"`
+	Message   string `json:"message"`
+}
+
+func (t TrustPolicyFailure) String() string {
+	if t.Statement == "" {
+		return fmt.Sprintf("%s: %s", t.Check, t.Message)
+	}
+	return fmt.Sprintf("statement %s: %s: %s", t.Statement, t.Check, t.Message)
+}
+
+type EventDetail struct {
+	EventTime       time.Time `json:"eventTime"`
+	EventId         string    `json:"eventId"`
+	EventName       string    `json:"eventName"`
+	ErrorCode       string    `json:"errorCode"`
+	ErrorMessage    string    `json:"errorMessage"`
+	RequestRoleArn  string    `json:"requestRoleArn"`
+	RoleSessionName string    `json:"roleSessionName"`
+	SourceIP        string    `json:"sourceIP"`
+	UserAgent       string    `json:"userAgent"`
+}
+
+type ClusterDetail struct {
+	Name         string        `json:"name"`
+	Arn          string        `json:"arn"`
+	Status       string        `json:"status"`
+	Endpoint     string        `json:"endpoint"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	OidcIssuer   OidcIssuer    `json:"oidcIssuer"`
+	OidcProvider *OidcProvider `json:"oidcProvider"`
+	// DuplicateOidcProviders have the same url as OidcProvider, NearOidcProviders have similar url
+	DuplicateOidcProviders []string `json:"duplicateOidcProviders"`
+	NearOidcProviders      []string `json:"nearOidcProviders"`
+	Failed                 bool     `json:"failed"`
+	Checks                 []Check  `json:"checks"`
+}
+
+// OidcIssuer Thumbprint is sha1 fingerprint of the last certificate in the chain
+type OidcIssuer struct {
+	Url          string               `json:"url"`
+	Thumbprint   string               `json:"thumbprint"`
+	Certificates []CertificateDetail  `json:"certificates"`
+	Discovery    *OidcDiscoveryDetail `json:"discovery"`
+}
+
+// CertificateDetail InThumbprints is true if the certificate sha1 fingerprint is in IAM oidc provider thumbprints
+type CertificateDetail struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	NotBefore     time.Time `json:"notBefore"`
+	NotAfter      time.Time `json:"notAfter"`
+	SHA1          string    `json:"sha1"`
+	SHA256        string    `json:"sha256"`
+	Expired       bool      `json:"expired"`
+	InThumbprints bool      `json:"inThumbprints"`
+}
+
+// OidcDiscoveryDetail IssuerMatch is true if the discovery document issuer is the cluster oidc issuer, Error is set
+// if the discovery document or JWKS could not be fetched
+type OidcDiscoveryDetail struct {
+	Url              string      `json:"url"`
+	Issuer           string      `json:"issuer"`
+	IssuerMatch      bool        `json:"issuerMatch"`
+	JwksUri          string      `json:"jwksUri"`
+	SigningAlgValues []string    `json:"signingAlgValues"`
+	Keys             []JWKDetail `json:"keys"`
+	Error            string      `json:"error,omitempty"`
+}
+
+type JWKDetail struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type OidcProvider struct {
+	Arn               string             `json:"arn"`
+	Url               string             `json:"url"`
+	CreateDate        time.Time          `json:"createDate"`
+	ClientIDs         []string           `json:"clientIds"`
+	Thumbprints       []string           `json:"thumbprints"`
+	ThumbprintMatches []ThumbprintDetail `json:"thumbprintMatches"`
+}
+
+// ThumbprintDetail Subject is the subject of the issuer chain certificate with the thumbprint, empty if the thumbprint
+// does not match any certificate in the chain
+type ThumbprintDetail struct {
+	Thumbprint string `json:"thumbprint"`
+	Subject    string `json:"subject"`
+	Expired    bool   `json:"expired"`
+}
+
+type DoctorReport struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Failed    bool    `json:"failed"`
+	Checks    []Check `json:"checks"`
+}
+
+// StaleReport Restart contains deduplicated commands to restart owners of the stale pods
+type StaleReport struct {
+	Pods    []StalePodDetail `json:"pods"`
+	Restart []string         `json:"restart"`
+}
+
+type StalePodDetail struct {
+	Namespace               string    `json:"namespace"`
+	ServiceAccount          string    `json:"serviceAccount"`
+	Name                    string    `json:"name"`
+	CreatedAt               time.Time `json:"createdAt"`
+	Reason                  string    `json:"reason"`
+	Owner                   string    `json:"owner"`
+	AnnotationRoleArn       string    `json:"annotationRoleArn"`
+	InjectedRoleArn         string    `json:"injectedRoleArn"`
+	RoleArnAnnotatedAt      time.Time `json:"roleArnAnnotatedAt"`
+	CreatedBeforeAnnotation bool      `json:"createdBeforeAnnotation"`
+}
+
+// CanIReport Statement is the deciding statement, not set for implicit deny
+type CanIReport struct {
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	RoleArn    string            `json:"roleArn"`
+	Action     string            `json:"action"`
+	Resource   string            `json:"resource"`
+	Allowed    bool              `json:"allowed"`
+	Decision   string            `json:"decision"`
+	Statement  *PolicyStatement  `json:"statement"`
+	Reason     string            `json:"reason"`
+	Notes      []string          `json:"notes"`
+	Simulation *SimulationDetail `json:"simulation,omitempty"`
+}
+
+type PolicyStatement struct {
+	Policy    string `json:"policy"`
+	Statement string `json:"statement"`
+	Effect    string `json:"effect"`
+}
+
+// SimulationDetail Match is true if IAM policy simulator decision is the same as the local evaluation decision
+type SimulationDetail struct {
+	Decision          string   `json:"decision"`
+	MatchedStatements []string `json:"matchedStatements"`
+	Match             bool     `json:"match"`
+}
+
+// AuditReport Findings are sorted by category, Namespace and ServiceAccount are empty for role findings
+type AuditReport struct {
+	Cluster  string         `json:"cluster"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+type AuditFinding struct {
+	Category       string `json:"category"`
+	Namespace      string `json:"namespace,omitempty"`
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	RoleArn        string `json:"roleArn"`
+	Detail         string `json:"detail"`
+}
+
+// LintReport Severity is minimum reported severity, Failed is true if there are any findings
+type LintReport struct {
+	Severity string        `json:"severity"`
+	Failed   bool          `json:"failed"`
+	Findings []LintFinding `json:"findings"`
+}
+
+// ActivityReport Sessions are the looked up (latest) role sessions out of TotalSessions, Actions are API calls made with
+// the sessions grouped by service and action, and Errors are failed calls (latest first)
+type ActivityReport struct {
+	Namespace     string                 `json:"namespace"`
+	Name          string                 `json:"name"`
+	RoleArn       string                 `json:"roleArn"`
+	TotalSessions int                    `json:"totalSessions"`
+	Sessions      []ActivitySession      `json:"sessions"`
+	Actions       []ActionActivityDetail `json:"actions"`
+	Errors        []EventDetail          `json:"errors"`
+}
+
+// ActivitySession Assumed is number of AssumeRoleWithWebIdentity calls (credential refreshes) and Events is number of
+// API calls made with the session
+type ActivitySession struct {
+	RoleSessionName string    `json:"roleSessionName"`
+	AssumedRoleArn  string    `json:"assumedRoleArn"`
+	FirstSeen       time.Time `json:"firstSeen"`
+	LastSeen        time.Time `json:"lastSeen"`
+	Assumed         int       `json:"assumed"`
+	Events          int       `json:"events"`
+}
+
+type ActionActivityDetail struct {
+	Service    string    `json:"service"`
+	Action     string    `json:"action"`
+	Count      int       `json:"count"`
+	Errors     int       `json:"errors"`
+	ErrorCodes []string  `json:"errorCodes"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// SuggestPolicyReport Policy is suggested identity policy document, Denied are actions of failed calls that are not
+// in the suggested policy and Diff is nil if the role policies could not be fetched
+type SuggestPolicyReport struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	RoleArn   string            `json:"roleArn"`
+	Sessions  int               `json:"sessions"`
+	Events    int               `json:"events"`
+	Policy    json.RawMessage   `json:"policy"`
+	Denied    []string          `json:"denied"`
+	Diff      *PolicyDiffDetail `json:"diff"`
+	// Notes are limitations of the observed activity e.g. data events are not returned by LookupEvents API
+	Notes []string `json:"notes"`
+}
+
+// PolicyDiffDetail Unused are allowed actions that were not called, Missing are called actions not allowed by the role
+// policies and Notes are statements that could not be compared
+type PolicyDiffDetail struct {
+	Unused  []UnusedPermissionDetail   `json:"unused"`
+	Missing []ObservedPermissionDetail `json:"missing"`
+	Notes   []string                   `json:"notes"`
+}
+
+type UnusedPermissionDetail struct {
+	Policy    string `json:"policy"`
+	Statement string `json:"statement"`
+	Action    string `json:"action"`
+}
+
+type ObservedPermissionDetail struct {
+	Action    string   `json:"action"`
+	Resources []string `json:"resources"`
+}
+
+// LintFinding Severity is risk severity, or error if the role could not be evaluated
+type LintFinding struct {
+	Severity       string `json:"severity"`
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	RoleArn        string `json:"roleArn"`
+	Statement      string `json:"statement,omitempty"`
+	Check          string `json:"check"`
+	Message        string `json:"message"`
+}
+
+// TokenReport does not contain the raw token, only decoded header and claims
+type TokenReport struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Audience  string          `json:"audience"`
+	Header    TokenHeader     `json:"header"`
+	Claims    TokenClaims     `json:"claims"`
+	Discovery *TokenDiscovery `json:"discovery"`
+	Failed    bool            `json:"failed"`
+	Checks    []Check         `json:"checks"`
+}
+
+type TokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type TokenClaims struct {
+	Issuer     string            `json:"iss"`
+	Subject    string            `json:"sub"`
+	Audience   []string          `json:"aud"`
+	IssuedAt   time.Time         `json:"iat"`
+	ExpiresAt  time.Time         `json:"exp"`
+	Kubernetes *KubernetesClaims `json:"kubernetes"`
+}
+
+type KubernetesClaims struct {
+	Namespace         string `json:"namespace"`
+	ServiceAccount    string `json:"serviceAccount"`
+	ServiceAccountUid string `json:"serviceAccountUid"`
+	Pod               string `json:"pod,omitempty"`
+}
+
+type TokenDiscovery struct {
+	Url     string `json:"url"`
+	Issuer  string `json:"issuer"`
+	JwksUri string `json:"jwksUri"`
+}
+
+func toServiceAccountSummary(sa k8s.ServiceAccount, events aws.Events) ServiceAccountSummary {
+	return ServiceAccountSummary{
+		Namespace:    sa.Namespace,
+		Name:         sa.Name,
+		Mechanism:    string(sa.Mechanism()),
+		Pods:         len(sa.Pods),
+		RoleArn:      sa.RoleArn(),
+		RoleAccount:  sa.RoleAccount(),
+		RoleName:     sa.RoleName(),
+		Events:       len(events),
+		FailedEvents: len(events.FailedEvents()),
+	}
+}
+
+// toPodDetails returns pod details, pods are flagged if their injected role arn is different from the service account
+// annotation
+func toPodDetails(sa k8s.ServiceAccount) []PodDetail {
+	out := make([]PodDetail, 0, len(sa.Pods))
+	for _, pod := range sa.Pods {
+		item := PodDetail{
+			Name:            pod.Name,
+			CreatedAt:       pod.CreatedAt,
+			Phase:           pod.Phase,
+			RoleArn:         pod.RoleArn(),
+			RoleArnMismatch: sa.IamRoleArn != "" && pod.RoleArnMismatch(sa.IamRoleArn),
+			TokenVolume:     pod.TokenVolume != nil,
+		}
+		if pod.TokenVolume != nil {
+			item.TokenAudience = pod.TokenVolume.Audience
+			item.TokenExpirationSeconds = pod.TokenVolume.ExpirationSeconds
+		}
+		for _, container := range pod.Containers {
+			if item.WebIdentityTokenFile == "" {
+				item.WebIdentityTokenFile = container.WebIdentityTokenFile
+			}
+			if item.ContainerCredentialsFullUri == "" {
+				item.ContainerCredentialsFullUri = container.ContainerCredentialsFullUri
+			}
+			item.Containers = append(item.Containers, ContainerDetail{
+				Name:                        container.Name,
+				Init:                        container.Init,
+				Skipped:                     container.Skipped,
+				RoleArn:                     container.RoleArn,
+				WebIdentityTokenFile:        container.WebIdentityTokenFile,
+				StsRegionalEndpoints:        container.StsRegionalEndpoints,
+				Region:                      container.Region,
+				ContainerCredentialsFullUri: container.ContainerCredentialsFullUri,
+				TokenVolumeMounted:          container.TokenVolumeMounted,
+			})
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// toRoleDetail returns nil if the role was not found
+func toRoleDetail(role aws.Role) *RoleDetail {
+	if role.ARN == "" {
+		return nil
+	}
+	return &RoleDetail{
+		Arn:                      role.ARN,
+		Name:                     role.Name,
+		Description:              role.Description,
+		CreateDate:               role.CreateDate,
+		RoleLastUsed:             role.RoleLastUsed,
+		AssumeRolePolicyDocument: toRawDocument(role.AssumeRolePolicyDocument),
+		PermissionsBoundaryArn:   role.PermissionsBoundaryArn,
+	}
+}
+
+func toRolePolicies(policies aws.RolePolicies) *RolePolicies {
+	out := &RolePolicies{
+		Attached: make([]PolicyDetail, 0, len(policies.Attached)),
+		Inline:   make([]PolicyDetail, 0, len(policies.Inline)),
+	}
+	for _, policy := range policies.Attached {
+		out.Attached = append(out.Attached, toPolicyDetail(policy))
+	}
+	for _, policy := range policies.Inline {
+		out.Inline = append(out.Inline, toPolicyDetail(policy))
+	}
+	if policies.PermissionsBoundary != nil {
+		boundary := toPolicyDetail(*policies.PermissionsBoundary)
+		out.PermissionsBoundary = &boundary
+	}
+	return out
+}
+
+func toPolicyDetail(policy aws.Policy) PolicyDetail {
+	return PolicyDetail{
+		Name:      policy.Name,
+		Arn:       policy.Arn,
+		VersionId: policy.VersionId,
+		Document:  toRawDocument(policy.Document),
+	}
+}
+
+// toRawDocument returns nil if the document is not valid json, so the output is still valid json
+func toRawDocument(document string) json.RawMessage {
+	out := json.RawMessage(document)
+	if !json.Valid(out) {
+		return nil
+	}
+	return out
+}
+
+func toTrustPolicy(verdict aws.TrustVerdict) *TrustPolicy {
+	failures := make([]TrustPolicyFailure, 0, len(verdict.Failures))
+	for _, failure := range verdict.Failures {
+		failures = append(failures, TrustPolicyFailure{
+			Statement: failure.Statement,
+			Check:     string(failure.Check),
+			Message:   failure.Message,
+		})
+	}
+	return &TrustPolicy{Allowed: verdict.Allowed, Statement: verdict.Statement, Failures: failures}
+}
+
+func toTrustRiskDetails(risks []aws.TrustRisk) []TrustRiskDetail {
+	out := make([]TrustRiskDetail, 0, len(risks))
+	for _, risk := range risks {
+		out = append(out, TrustRiskDetail{
+			Severity:  string(risk.Severity),
+			Check:     string(risk.Check),
+			Statement: risk.Statement,
+			Message:   risk.Message,
+		})
+	}
+	return out
+}
+
+func toFailureGroupDetails(groups []aws.FailureGroup) []FailureGroupDetail {
+	out := make([]FailureGroupDetail, 0, len(groups))
+	for _, group := range groups {
+		out = append(out, FailureGroupDetail{
+			Cause:  string(group.Cause),
+			Count:  group.Count,
+			Latest: group.Latest,
+			Detail: group.Detail,
+			Fix:    group.Cause.Fix(),
+		})
+	}
+	return out
+}
+
+func toActivitySession(session aws.Session, events int) ActivitySession {
+	return ActivitySession{
+		RoleSessionName: session.RoleSessionName,
+		AssumedRoleArn:  session.AssumedRoleArn,
+		FirstSeen:       session.FirstSeen,
+		LastSeen:        session.LastSeen,
+		Assumed:         session.Count,
+		Events:          events,
+	}
+}
+
+func toActionActivityDetails(activity []aws.ActionActivity) []ActionActivityDetail {
+	out := make([]ActionActivityDetail, 0, len(activity))
+	for _, action := range activity {
+		out = append(out, ActionActivityDetail{
+			Service:    action.Service,
+			Action:     action.Action,
+			Count:      action.Count,
+			Errors:     action.Errors,
+			ErrorCodes: append([]string{}, action.ErrorCodes...),
+			LastSeen:   action.LastSeen,
+		})
+	}
+	return out
+}
+
+func toPolicyDiffDetail(diff aws.PolicyDiff) PolicyDiffDetail {
+	out := PolicyDiffDetail{
+		Unused:  make([]UnusedPermissionDetail, 0, len(diff.Unused)),
+		Missing: make([]ObservedPermissionDetail, 0, len(diff.Missing)),
+		Notes:   append([]string{}, diff.Notes...),
+	}
+	for _, unused := range diff.Unused {
+		out.Unused = append(out.Unused, UnusedPermissionDetail{Policy: unused.Policy, Statement: unused.Statement, Action: unused.Action})
+	}
+	for _, missing := range diff.Missing {
+		out.Missing = append(out.Missing, ObservedPermissionDetail{Action: missing.Action, Resources: missing.Resources})
+	}
+	return out
+}
+
+func toEventDetails(events aws.Events) []EventDetail {
+	out := make([]EventDetail, 0, len(events))
+	for _, event := range events {
+		out = append(out, EventDetail{
+			EventTime:       event.EventTime,
+			EventId:         event.EventId,
+			EventName:       event.EventName,
+			ErrorCode:       event.ErrorCode,
+			ErrorMessage:    event.ErrorMessage,
+			RequestRoleArn:  event.RequestParameters.RoleArn,
+			RoleSessionName: event.RequestParameters.RoleSessionName,
+			SourceIP:        event.SourceIP,
+			UserAgent:       event.UserAgent,
+		})
+	}
+	return out
+}
+
+func toClusterDetail(cluster aws.Cluster, chain []aws.Certificate, discovery *OidcDiscoveryDetail, oidcProvider aws.OidcProvider, now time.Time) ClusterDetail {
+	out := ClusterDetail{
+		Name:       cluster.Name,
+		Arn:        cluster.Arn,
+		Status:     cluster.Status,
+		Endpoint:   cluster.Endpoint,
+		CreatedAt:  cluster.CreatedAt,
+		OidcIssuer: OidcIssuer{Url: cluster.OidcIssuer, Discovery: discovery},
+	}
+	if len(chain) != 0 {
+		out.OidcIssuer.Thumbprint = chain[len(chain)-1].FingerprintSHA1
+	}
+	for _, certificate := range chain {
+		out.OidcIssuer.Certificates = append(out.OidcIssuer.Certificates, CertificateDetail{
+			Subject:       certificate.Subject,
+			Issuer:        certificate.Issuer,
+			NotBefore:     certificate.NotBefore,
+			NotAfter:      certificate.NotAfter,
+			SHA1:          certificate.FingerprintSHA1,
+			SHA256:        certificate.FingerprintSHA256,
+			Expired:       certificate.Expired(now),
+			InThumbprints: slices.ContainsFunc(oidcProvider.Thumbprints, func(v string) bool { return strings.EqualFold(v, certificate.FingerprintSHA1) }),
+		})
+	}
+	if oidcProvider.Url != "" {
+		out.OidcProvider = &OidcProvider{
+			Arn:         oidcProvider.Arn,
+			Url:         oidcProvider.Url,
+			CreateDate:  oidcProvider.CreateDate,
+			ClientIDs:   oidcProvider.ClientIDs,
+			Thumbprints: oidcProvider.Thumbprints,
+		}
+		for _, match := range aws.MatchThumbprints(oidcProvider.Thumbprints, chain) {
+			detail := ThumbprintDetail{Thumbprint: match.Thumbprint}
+			if match.Certificate != nil {
+				detail.Subject = match.Certificate.Subject
+				detail.Expired = match.Certificate.Expired(now)
+			}
+			out.OidcProvider.ThumbprintMatches = append(out.OidcProvider.ThumbprintMatches, detail)
+		}
+	}
+	return out
+}
+
+func toOidcDiscoveryDetail(issuer string, discovery aws.OidcDiscovery, jwks aws.JWKS) *OidcDiscoveryDetail {
+	out := &OidcDiscoveryDetail{
+		Url:              aws.DiscoveryUrl(issuer),
+		Issuer:           discovery.Issuer,
+		IssuerMatch:      discovery.Issuer == issuer,
+		JwksUri:          discovery.JwksUri,
+		SigningAlgValues: discovery.IdTokenSigningAlgValuesSupported,
+	}
+	for _, key := range jwks.Keys {
+		out.Keys = append(out.Keys, JWKDetail{Kid: key.Kid, Kty: key.Kty, Alg: key.Alg, Use: key.Use})
+	}
+	return out
+}
+
+func toStalePodDetail(sa k8s.ServiceAccount, stalePod k8s.StalePod) StalePodDetail {
+	return StalePodDetail{
+		Namespace:               stalePod.Pod.Namespace,
+		ServiceAccount:          sa.Name,
+		Name:                    stalePod.Pod.Name,
+		CreatedAt:               stalePod.Pod.CreatedAt,
+		Reason:                  stalePod.Reason,
+		Owner:                   stalePod.Owner.String(),
+		AnnotationRoleArn:       sa.IamRoleArn,
+		InjectedRoleArn:         stalePod.Pod.RoleArn(),
+		RoleArnAnnotatedAt:      sa.RoleArnAnnotatedAt,
+		CreatedBeforeAnnotation: stalePod.CreatedBeforeAnnotation,
+	}
+}
+
+func toCanIReport(sa k8s.ServiceAccount, request aws.PermissionRequest, verdict aws.PermissionVerdict) CanIReport {
+	out := CanIReport{
+		Namespace: sa.Namespace,
+		Name:      sa.Name,
+		RoleArn:   sa.RoleArn(),
+		Action:    request.Action,
+		Resource:  request.Resource,
+		Allowed:   verdict.Allowed(),
+		Decision:  string(verdict.Decision),
+		Reason:    verdict.Reason,
+		Notes:     append([]string{}, verdict.Notes...),
+	}
+	if verdict.Statement != nil {
+		out.Statement = &PolicyStatement{
+			Policy:    verdict.Statement.Policy,
+			Statement: verdict.Statement.Statement,
+			Effect:    verdict.Statement.Effect,
+		}
+	}
+	return out
+}
+
+func toTokenClaims(claims aws.TokenClaims) TokenClaims {
+	out := TokenClaims{
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		IssuedAt:  claims.IssuedAtTime(),
+		ExpiresAt: claims.ExpiresAtTime(),
+	}
+	if claims.Kubernetes != nil {
+		out.Kubernetes = &KubernetesClaims{
+			Namespace:         claims.Kubernetes.Namespace,
+			ServiceAccount:    claims.Kubernetes.ServiceAccount.Name,
+			ServiceAccountUid: claims.Kubernetes.ServiceAccount.UID,
+		}
+		if claims.Kubernetes.Pod != nil {
+			out.Kubernetes.Pod = claims.Kubernetes.Pod.Name
+		}
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	cmdStale = &cobra.Command{
+		Use:   "stale",
+		Short: "list pods that need to be restarted to pick up IAM role annotation change",
+		Long:  "",
+		Run:   runStaleCmd,
+	}
+)
+
+var staleRestart bool
+
+func init() {
+	cmdStale.Flags().BoolVar(
+		&staleRestart,
+		"restart",
+		false,
+		"rollout restart owners (deployments, stateful sets, daemon sets) of stale pods, after confirmation",
+	)
+	RootCmd.AddCommand(cmdStale)
+}
+
+func runStaleCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// only IRSA annotation is injected at pod creation, pod identity associations are not needed
+	sas, err := k8sClient.ListIAMServiceAccounts(GlobalFlags.Namespace(), GlobalFlags.Label(), GlobalFlags.FieldSelector(args), nil)
+	if err != nil {
+		fmt.Printf("list IAM service accounts: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := StaleReport{Pods: []StalePodDetail{}, Restart: []string{}}
+	var owners []k8s.Owner
+	for _, sa := range sas {
+		for _, stalePod := range k8sClient.StalePods(sa) {
+			report.Pods = append(report.Pods, toStalePodDetail(sa, stalePod))
+			if !slices.Contains(owners, stalePod.Owner) {
+				owners = append(owners, stalePod.Owner)
+				report.Restart = append(report.Restart, stalePod.Owner.RestartCommand())
+			}
+		}
+	}
+	GlobalFlags.Output(logger).Print(KindStaleReport, report, func() { printStale(logger, report) })
+
+	if staleRestart {
+		restartOwners(logger, k8sClient, owners, os.Stdin, os.Stderr)
+	}
+}
+
+// restartOwners asks for confirmation and then rollout restarts owners, owners that cannot be rollout restarted (jobs,
+// bare pods) are skipped. Prompt and results are written to w (stderr), so they do not mix with json or yaml report
+func restartOwners(logger *slog.Logger, k8sClient k8s.Client, owners []k8s.Owner, in io.Reader, w io.Writer) {
+	var restartable []k8s.Owner
+	for _, owner := range owners {
+		if owner.RolloutRestartable() {
+			restartable = append(restartable, owner)
+			continue
+		}
+		logger.Warn(fmt.Sprintf("%s/%s cannot be rollout restarted, skipping", owner.Namespace, owner))
+	}
+	if len(restartable) == 0 {
+		fmt.Fprintln(w, "nothing to restart")
+		return
+	}
+
+	fmt.Fprintf(w, "restart %d workloads? [y/N]: ", len(restartable))
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		fmt.Fprintln(w, "aborted")
+		return
+	}
+
+	var failed bool
+	for _, owner := range restartable {
+		if err := k8sClient.RolloutRestart(owner); err != nil {
+			fmt.Fprintf(w, "restart %s/%s: %v\n", owner.Namespace, owner, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(w, "%s/%s restarted\n", owner.Namespace, owner)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printStale(logger *slog.Logger, report StaleReport) {
+	if len(report.Pods) == 0 {
+		fmt.Println("no stale pods found")
+		return
+	}
+
+	table := out.NewTable(logger)
+	table.AddRow("NAMESPACE", "SERVICE ACCOUNT", "POD", "REASON", "OWNER", "CREATED BEFORE ANNOTATION")
+	for _, pod := range report.Pods {
+		table.AddRow(pod.Namespace, pod.ServiceAccount, pod.Name, pod.Reason, pod.Owner, fmt.Sprintf("%t", pod.CreatedBeforeAnnotation))
+	}
+	table.Print()
+
+	fmt.Println()
+	fmt.Println("restart:")
+	for _, command := range report.Restart {
+		fmt.Printf("  %s\n", command)
+	}
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/pete911/kubectl-iam4sa/internal/out"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	cmdSuggestPolicy = &cobra.Command{
+		Use:   "suggest-policy <service-account>",
+		Short: "suggest least-privilege IAM policy from API calls made with IRSA role sessions of the service account",
+		Long:  "",
+		Args:  cobra.ExactArgs(1),
+		Run:   runSuggestPolicyCmd,
+	}
+)
+
+var suggestPolicySessions int
+
+func init() {
+	cmdSuggestPolicy.Flags().IntVar(
+		&suggestPolicySessions,
+		"sessions",
+		10,
+		"maximum number of the latest role sessions to look up events for, minimum is 1, each session is a separate cloudtrail lookup",
+	)
+	RootCmd.AddCommand(cmdSuggestPolicy)
+}
+
+func runSuggestPolicyCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+	if suggestPolicySessions < 1 {
+		fmt.Printf("sessions %d is less than 1\n", suggestPolicySessions)
+		os.Exit(1)
+	}
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// role sessions are created only by IRSA, pod identity associations are not needed
+	sa, err := k8sClient.GetServiceAccount(GlobalFlags.namespace, args[0], nil)
+	if err != nil {
+		fmt.Printf("get service account %s/%s: %v\n", GlobalFlags.namespace, args[0], err)
+		os.Exit(1)
+	}
+	if sa.IamRoleArn == "" {
+		fmt.Printf("service account %s/%s does not have eks.amazonaws.com/role-arn annotation\n", sa.Namespace, sa.Name)
+		os.Exit(1)
+	}
+
+	report, err := suggestPolicy(logger, awsClient, sa, GlobalFlags.EventsFilter(), suggestPolicySessions)
+	if err != nil {
+		fmt.Printf("suggest policy: %v\n", err)
+		os.Exit(1)
+	}
+	GlobalFlags.Output(logger).Print(KindSuggestPolicyReport, report, func() { printSuggestPolicy(logger, report) })
+}
+
+// suggestPolicy builds policy from observed successful API calls of the latest role sessions, and compares it with
+// the current role policies. Policy diff is not set if the role policies cannot be fetched.
+func suggestPolicy(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, filter aws.EventsFilter, maxSessions int) (SuggestPolicyReport, error) {
+	sessions, err := lookupSessionEvents(logger, awsClient, sa, filter, maxSessions)
+	if err != nil {
+		return SuggestPolicyReport{}, err
+	}
+
+	permissions := sessions.Events.ObservedPermissions()
+	policy, err := json.MarshalIndent(aws.SuggestPolicy(permissions), "", "  ")
+	if err != nil {
+		return SuggestPolicyReport{}, fmt.Errorf("marshal policy: %w", err)
+	}
+	report := SuggestPolicyReport{
+		Namespace: sa.Namespace,
+		Name:      sa.Name,
+		RoleArn:   sa.IamRoleArn,
+		Sessions:  len(sessions.Sessions),
+		Events:    len(sessions.Events),
+		Policy:    policy,
+		Denied:    toDeniedActions(sessions.Events, permissions),
+		Notes:     []string{},
+	}
+	if !awsClient.ObservesDataEvents() {
+		report.Notes = append(report.Notes, "CloudTrail LookupEvents API does not return data events (e.g. s3:GetObject, "+
+			"dynamodb:GetItem, sqs:SendMessage), data event actions are not in the suggested policy and are not reported as unused, "+
+			"use --events-from or --event-store with data events")
+	}
+	if !awsClient.ObservesResources() {
+		report.Notes = append(report.Notes, "CloudTrail Lake event data store query does not return event resources, "+
+			"suggested policy has \"*\" resource for all actions, scope the resources or use --events-from with exported logs")
+	}
+
+	role, err := awsClient.GetIAMRole(sa.IamRoleArn)
+	if err != nil {
+		logger.Error(fmt.Sprintf("get role %s: %v", sa.IamRoleArn, err))
+		return report, nil
+	}
+	policies, err := awsClient.GetIAMRolePolicies(role)
+	if err != nil {
+		logger.Error(fmt.Sprintf("get role %s policies: %v", sa.IamRoleArn, err))
+		return report, nil
+	}
+	diff := toPolicyDiffDetail(aws.DiffPolicies(policies, permissions, awsClient.ObservesDataEvents()))
+	report.Diff = &diff
+	return report, nil
+}
+
+// toDeniedActions returns distinct IAM actions of failed calls that were never successful, these might be needed by
+// the workload, but are not part of the suggested policy
+func toDeniedActions(events aws.Events, permissions []aws.ObservedPermission) []string {
+	out := make([]string, 0)
+	for _, event := range events.FailedEvents() {
+		action := event.IAMAction()
+		if !slices.Contains(out, action) && !slices.ContainsFunc(permissions, func(p aws.ObservedPermission) bool { return p.Action == action }) {
+			out = append(out, action)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func printSuggestPolicy(logger *slog.Logger, report SuggestPolicyReport) {
+	fmt.Printf("Service Account: %s/%s\n", report.Namespace, report.Name)
+	fmt.Printf("Role:            %s\n", report.RoleArn)
+	fmt.Printf("Observed:        %d events in %d sessions\n", report.Events, report.Sessions)
+	fmt.Println()
+	fmt.Println("Suggested Policy:")
+	fmt.Println(string(report.Policy))
+
+	if len(report.Denied) != 0 {
+		fmt.Println()
+		fmt.Printf("Denied (not in suggested policy): %s\n", strings.Join(report.Denied, ", "))
+	}
+	for _, note := range report.Notes {
+		fmt.Printf("note: %s\n", note)
+	}
+	if report.Diff == nil {
+		return
+	}
+
+	fmt.Println()
+	if len(report.Diff.Unused) == 0 {
+		fmt.Println("Unused Permissions: none")
+	} else {
+		fmt.Println("Unused Permissions:")
+		table := out.NewTable(logger)
+		table.AddRow("POLICY", "STATEMENT", "ACTION")
+		for _, unused := range report.Diff.Unused {
+			table.AddRow(unused.Policy, unused.Statement, unused.Action)
+		}
+		table.Print()
+	}
+	if len(report.Diff.Missing) != 0 {
+		fmt.Println()
+		fmt.Println("Not Allowed By Role Policies:")
+		for _, missing := range report.Diff.Missing {
+			fmt.Printf("  %s %s\n", missing.Action, strings.Join(missing.Resources, ", "))
+		}
+	}
+	for _, note := range report.Diff.Notes {
+		fmt.Printf("note: %s\n", note)
+	}
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	"github.com/pete911/kubectl-iam4sa/internal/k8s"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	cmdToken = &cobra.Command{
+		Use:   "token <service-account>",
+		Short: "request and verify service account token against cluster oidc issuer and role trust policy",
+		Long:  "",
+		Args:  cobra.ExactArgs(1),
+		Run:   runTokenCmd,
+	}
+)
+
+var (
+	tokenAudience   string
+	tokenExpiration time.Duration
+)
+
+func init() {
+	cmdToken.Flags().StringVar(
+		&tokenAudience,
+		"audience",
+		"",
+		"token audience (default pod token volume audience, eks.amazonaws.com/audience annotation or sts.amazonaws.com)",
+	)
+	cmdToken.Flags().DurationVar(
+		&tokenExpiration,
+		"expiration",
+		10*time.Minute,
+		"token expiration, minimum is 10 minutes",
+	)
+	RootCmd.AddCommand(cmdToken)
+}
+
+func runTokenCmd(_ *cobra.Command, args []string) {
+	logger := GlobalFlags.Logger()
+	kubeconfig := GlobalFlags.Kubeconfig()
+	if tokenExpiration < 10*time.Minute {
+		fmt.Printf("token expiration %s is less than 10m\n", tokenExpiration)
+		os.Exit(1)
+	}
+
+	k8sClient, err := k8s.NewClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("k8s client: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger.Debug(fmt.Sprintf("kubeconfig: %s", kubeconfig))
+	awsClient, err := newAWSClient(logger, kubeconfig)
+	if err != nil {
+		fmt.Printf("aws client: %v\n", err)
+		os.Exit(1)
+	}
+
+	sa, err := k8sClient.GetServiceAccount(GlobalFlags.namespace, args[0], nil)
+	if err != nil {
+		fmt.Printf("get service account %s/%s: %v\n", GlobalFlags.namespace, args[0], err)
+		os.Exit(1)
+	}
+
+	audience := getTokenAudience(sa, tokenAudience)
+	rawToken, err := k8sClient.CreateToken(sa.Namespace, sa.Name, audience, int64(tokenExpiration.Seconds()))
+	if err != nil {
+		fmt.Printf("create %s/%s token: %v\n", sa.Namespace, sa.Name, err)
+		os.Exit(1)
+	}
+	token, err := aws.ParseToken(rawToken)
+	if err != nil {
+		fmt.Printf("parse token: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := runTokenChecks(logger, awsClient, sa, audience, token)
+	GlobalFlags.Output(logger).Print(KindTokenReport, report, func() { printToken(report) })
+	if report.Failed {
+		os.Exit(1)
+	}
+}
+
+// getTokenAudience returns audience the same way pod identity webhook does, audience from injected pod token volume
+// takes precedence over the annotation, because pods are not updated when the annotation changes
+func getTokenAudience(sa k8s.ServiceAccount, audience string) string {
+	if audience != "" {
+		return audience
+	}
+	for _, pod := range sa.Pods {
+		if pod.TokenVolume != nil && pod.TokenVolume.Audience != "" {
+			return pod.TokenVolume.Audience
+		}
+	}
+	if sa.Audience != "" {
+		return sa.Audience
+	}
+	return aws.DefaultAudience
+}
+
+// runTokenChecks verifies token claims against the cluster, signature against the issuer JWKS and claims against the
+// role trust policy
+func runTokenChecks(logger *slog.Logger, awsClient aws.Client, sa k8s.ServiceAccount, audience string, token aws.Token) TokenReport {
+	report := TokenReport{
+		Namespace: sa.Namespace,
+		Name:      sa.Name,
+		Audience:  audience,
+		Header:    TokenHeader{Alg: token.Header.Alg, Kid: token.Header.Kid, Typ: token.Header.Typ},
+		Claims:    toTokenClaims(token.Claims),
+	}
+
+	var checks Checks
+	cluster, err := awsClient.DescribeCluster()
+	if err != nil {
+		checks.Fail("token issuer", fmt.Sprintf("describe cluster: %v", err), "verify cluster name and region in kubeconfig, and eks:DescribeCluster permission")
+	} else if token.Claims.Issuer != cluster.OidcIssuer {
+		checks.Fail("token issuer", fmt.Sprintf("token issuer %s does not match cluster issuer %s", token.Claims.Issuer, cluster.OidcIssuer),
+			"api server --service-account-issuer is not the cluster oidc issuer")
+	} else {
+		checks.Pass("token issuer", token.Claims.Issuer)
+	}
+
+	subject := fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+	if token.Claims.Subject != subject {
+		checks.Fail("token subject", fmt.Sprintf("subject %s, expected %s", token.Claims.Subject, subject), "")
+	} else {
+		checks.Pass("token subject", subject)
+	}
+	if !token.Claims.HasAudience(audience) {
+		checks.Fail("token audience", fmt.Sprintf("audience %s does not contain %s", strings.Join(token.Claims.Audience, ", "), audience), "")
+	} else {
+		checks.Pass("token audience", audience)
+	}
+	if expiresAt := token.Claims.ExpiresAtTime(); expiresAt.Before(time.Now()) {
+		checks.Fail("token expiry", fmt.Sprintf("token expired at %s", expiresAt.Format(time.RFC3339)), "verify clock on the cluster and local machine")
+	} else {
+		checks.Pass("token expiry", fmt.Sprintf("expires at %s", expiresAt.Format(time.RFC3339)))
+	}
+
+	checkTokenSignature(&checks, &report, token)
+
+	if sa.IamRoleArn == "" {
+		checks.Warn("trust policy", "service account does not have IRSA role annotation", "annotate the service account with eks.amazonaws.com/role-arn")
+	} else if cluster.Arn != "" {
+		role, err := awsClient.GetIAMRole(sa.IamRoleArn)
+		if err != nil {
+			logger.Error(fmt.Sprintf("get role %s: %v", sa.IamRoleArn, err))
+			checks.Fail("trust policy", fmt.Sprintf("get role: %v", err), "verify iam:GetRole permission")
+		} else {
+			checkWebIdentityTrust(&checks, role, token.WebIdentity(cluster))
+		}
+	}
+
+	report.Failed = checks.Failed()
+	report.Checks = checks
+	return report
+}
+
+// checkTokenSignature fetches issuer discovery document and JWKS, and verifies token signature
+func checkTokenSignature(checks *Checks, report *TokenReport, token aws.Token) {
+	name := "token signature"
+	discoveryUrl := aws.DiscoveryUrl(token.Claims.Issuer)
+	discovery, err := aws.GetOidcDiscovery(token.Claims.Issuer)
+	if err != nil {
+		checks.Fail(name, fmt.Sprintf("discovery: %v", err), "STS fetches the same document, verify that the issuer is publicly accessible")
+		return
+	}
+	report.Discovery = &TokenDiscovery{Url: discoveryUrl, Issuer: discovery.Issuer, JwksUri: discovery.JwksUri}
+	if discovery.Issuer != token.Claims.Issuer {
+		checks.Fail(name, fmt.Sprintf("discovery issuer %s does not match token issuer %s", discovery.Issuer, token.Claims.Issuer), "")
+		return
+	}
+
+	jwks, err := aws.GetJWKS(discovery.JwksUri)
+	if err != nil {
+		checks.Fail(name, fmt.Sprintf("jwks: %v", err), "STS fetches the same keys, verify that jwks uri is publicly accessible")
+		return
+	}
+	key, err := token.Verify(jwks)
+	if err != nil {
+		checks.Fail(name, err.Error(), "token is not signed by the issuer keys, verify api server service account signing key")
+		return
+	}
+	checks.Pass(name, fmt.Sprintf("%s signature verified with key %s from %s", token.Header.Alg, key.Kid, discovery.JwksUri))
+}
+
+func printToken(report TokenReport) {
+	fmt.Printf("Name:      %s\n", report.Name)
+	fmt.Printf("Namespace: %s\n", report.Namespace)
+	fmt.Printf("Audience:  %s\n", report.Audience)
+	fmt.Printf("Header:    alg %s, kid %s\n", report.Header.Alg, report.Header.Kid)
+	fmt.Println("Claims:")
+	fmt.Printf("  iss: %s\n", report.Claims.Issuer)
+	fmt.Printf("  sub: %s\n", report.Claims.Subject)
+	fmt.Printf("  aud: %s\n", strings.Join(report.Claims.Audience, ", "))
+	fmt.Printf("  iat: %s\n", report.Claims.IssuedAt.Format(time.RFC3339))
+	fmt.Printf("  exp: %s\n", report.Claims.ExpiresAt.Format(time.RFC3339))
+	if report.Claims.Kubernetes != nil {
+		fmt.Printf("  kubernetes.io: namespace %s, service account %s (%s)\n", report.Claims.Kubernetes.Namespace,
+			report.Claims.Kubernetes.ServiceAccount, report.Claims.Kubernetes.ServiceAccountUid)
+	}
+	if report.Discovery != nil {
+		fmt.Printf("Discovery: %s\n", report.Discovery.Url)
+		fmt.Printf("  jwks_uri: %s\n", report.Discovery.JwksUri)
+	}
+	fmt.Println()
+	printChecks(report.Checks)
+}
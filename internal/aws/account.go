@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"strings"
+)
+
+// CrossAccountPlaceholder is replaced with account id in CrossAccount RoleTemplate
+const CrossAccountPlaceholder = "{account}"
+
+// CrossAccount configures (read only) roles that are assumed to inspect IAM roles in other accounts. Roles maps account
+// id to role arn, RoleTemplate (e.g. arn:aws:iam::{account}:role/iam4sa-read) is used for accounts that are not in Roles.
+type CrossAccount struct {
+	Roles        map[string]string
+	RoleTemplate string
+}
+
+// RoleArn returns role arn to assume in the account, empty if there is no role configured for the account
+func (c CrossAccount) RoleArn(account string) string {
+	if roleArn, ok := c.Roles[account]; ok {
+		return roleArn
+	}
+	if c.RoleTemplate == "" {
+		return ""
+	}
+	return strings.ReplaceAll(c.RoleTemplate, CrossAccountPlaceholder, account)
+}
+
+// parseRoleArn returns role account and name (without path)
+func parseRoleArn(roleArn string) (account, name string, err error) {
+	if err := ValidateRoleArn(roleArn); err != nil {
+		return "", "", err
+	}
+	a, _ := arn.Parse(roleArn)
+	parts := strings.Split(a.Resource, "/")
+	return a.AccountID, parts[len(parts)-1], nil
+}
+
+// arnAccount returns account id of the arn, empty if the arn is not valid
+func arnAccount(v string) string {
+	a, err := arn.Parse(v)
+	if err != nil {
+		return ""
+	}
+	return a.AccountID
+}
+
+// iamClientFor returns IAM client for the account, cross account role is assumed for accounts other than the caller
+// account. Clients are cached and shared by all copies of the client.
+func (c Client) iamClientFor(account string) (*iam.Client, error) {
+	if account == "" || account == c.account {
+		return c.iamClient, nil
+	}
+	if v, ok := c.accountIamClients.Load(account); ok {
+		return v.(*iam.Client), nil
+	}
+
+	roleArn := c.crossAccount.RoleArn(account)
+	if roleArn == "" {
+		return nil, errs.NewErrForeignAccount(fmt.Sprintf("role in foreign account %s, trust policy not inspectable, set --cross-account-role flag", account))
+	}
+	c.logger.Debug(fmt.Sprintf("assuming %s role to inspect %s account", roleArn, account))
+	cfg := c.cfg.Copy()
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(c.cfg), roleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = roleSessionName
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	v, _ := c.accountIamClients.LoadOrStore(account, iam.NewFromConfig(cfg))
+	return v.(*iam.Client), nil
+}
@@ -0,0 +1,41 @@
+package aws
+
+import (
+	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestCrossAccount_RoleArn(t *testing.T) {
+	crossAccount := CrossAccount{
+		Roles:        map[string]string{"111111111111": "arn:aws:iam::111111111111:role/audit"},
+		RoleTemplate: "arn:aws:iam::{account}:role/read-only",
+	}
+	assert.Equal(t, "arn:aws:iam::111111111111:role/audit", crossAccount.RoleArn("111111111111"))
+	assert.Equal(t, "arn:aws:iam::222222222222:role/read-only", crossAccount.RoleArn("222222222222"))
+	assert.Empty(t, CrossAccount{}.RoleArn("222222222222"))
+}
+
+func Test_parseRoleArn(t *testing.T) {
+	account, name, err := parseRoleArn("arn:aws:iam::123456789123:role/path/app")
+	require.NoError(t, err)
+	assert.Equal(t, "123456789123", account)
+	assert.Equal(t, "app", name)
+
+	_, _, err = parseRoleArn("app")
+	assert.Error(t, err)
+}
+
+func TestClient_iamClientFor(t *testing.T) {
+	client := Client{logger: slog.Default(), account: "123456789123", accountIamClients: &sync.Map{}}
+
+	_, err := client.iamClientFor("123456789123")
+	assert.NoError(t, err)
+
+	_, err = client.iamClientFor("987654321987")
+	var errForeignAccount *errs.ErrForeignAccount
+	assert.ErrorAs(t, err, &errForeignAccount)
+}
@@ -0,0 +1,130 @@
+package aws
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Session is assumed role session created by successful AssumeRoleWithWebIdentity call, downstream API calls made
+// with the session credentials have AssumedRoleArn in the user identity
+type Session struct {
+	RoleSessionName string
+	AssumedRoleArn  string
+	// FirstSeen and LastSeen are times of the first and the last AssumeRoleWithWebIdentity call for the session
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Count     int
+}
+
+// Sessions returns distinct sessions from successful AssumeRoleWithWebIdentity events, sorted by last seen (latest
+// first). AWS SDKs reuse the session name when credentials are refreshed.
+func (e Events) Sessions() []Session {
+	var out []Session
+	index := make(map[string]int)
+	for _, event := range e.WebIdentityEvents() {
+		if event.Failed() || event.RequestParameters.RoleSessionName == "" {
+			continue
+		}
+		assumedRoleArn := event.ResponseElements.AssumedRoleUser.Arn
+		if assumedRoleArn == "" {
+			assumedRoleArn = toAssumedRoleArn(event.RequestParameters.RoleArn, event.RequestParameters.RoleSessionName)
+		}
+		if assumedRoleArn == "" {
+			continue
+		}
+
+		i, ok := index[assumedRoleArn]
+		if !ok {
+			index[assumedRoleArn] = len(out)
+			out = append(out, Session{
+				RoleSessionName: event.RequestParameters.RoleSessionName,
+				AssumedRoleArn:  assumedRoleArn,
+				FirstSeen:       event.EventTime,
+				LastSeen:        event.EventTime,
+			})
+			i = len(out) - 1
+		}
+		out[i].Count++
+		if event.EventTime.Before(out[i].FirstSeen) {
+			out[i].FirstSeen = event.EventTime
+		}
+		if event.EventTime.After(out[i].LastSeen) {
+			out[i].LastSeen = event.EventTime
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Session) int { return b.LastSeen.Compare(a.LastSeen) })
+	return out
+}
+
+// SessionEvents returns events made by the assumed role session
+func (e Events) SessionEvents(session Session) Events {
+	var out Events
+	for _, event := range e {
+		if event.UserIdentity.Arn == session.AssumedRoleArn {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// toAssumedRoleArn returns sts assumed role arn for iam role arn (role path is not part of assumed role arn), or empty
+// string if the role arn is invalid
+func toAssumedRoleArn(roleArn, sessionName string) string {
+	a, err := arn.Parse(roleArn)
+	if err != nil || !strings.HasPrefix(a.Resource, "role/") {
+		return ""
+	}
+	resource := strings.Split(a.Resource, "/")
+	name := resource[len(resource)-1]
+	return fmt.Sprintf("arn:%s:sts::%s:assumed-role/%s/%s", a.Partition, a.AccountID, name, sessionName)
+}
+
+// ActionActivity is count of API calls for one service action, Errors is count of failed calls and ErrorCodes are
+// distinct error codes of the failed calls
+type ActionActivity struct {
+	Service    string
+	Action     string
+	Count      int
+	Errors     int
+	ErrorCodes []string
+	LastSeen   time.Time
+}
+
+// Activity returns API calls grouped by service and action, sorted by service and action
+func (e Events) Activity() []ActionActivity {
+	var out []ActionActivity
+	index := make(map[string]int)
+	for _, event := range e {
+		service := eventService(event.EventSource)
+		key := service + ":" + event.EventName
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, ActionActivity{Service: service, Action: event.EventName})
+			i = len(out) - 1
+		}
+		out[i].Count++
+		if event.Failed() {
+			out[i].Errors++
+			if code := cmp.Or(event.ErrorCode, "unknown"); !slices.Contains(out[i].ErrorCodes, code) {
+				out[i].ErrorCodes = append(out[i].ErrorCodes, code)
+			}
+		}
+		if event.EventTime.After(out[i].LastSeen) {
+			out[i].LastSeen = event.EventTime
+		}
+	}
+	slices.SortFunc(out, func(a, b ActionActivity) int {
+		return cmp.Or(cmp.Compare(a.Service, b.Service), cmp.Compare(a.Action, b.Action))
+	})
+	return out
+}
+
+// eventService returns service prefix from the event source e.g. s3 for s3.amazonaws.com
+func eventService(eventSource string) string {
+	return strings.TrimSuffix(eventSource, ".amazonaws.com")
+}
@@ -0,0 +1,62 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEvents_Sessions(t *testing.T) {
+	t1 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	roleArn := "arn:aws:iam::123456789123:role/path/prometheus"
+	webIdentity := func(eventTime time.Time, session, assumedRoleArn, errorCode string) Event {
+		return Event{
+			EventTime:         eventTime,
+			EventName:         eventNameAssumeRoleWithWebIdentity,
+			ErrorCode:         errorCode,
+			RequestParameters: RequestParameters{RoleArn: roleArn, RoleSessionName: session},
+			ResponseElements:  ResponseElements{AssumedRoleUser: AssumedRoleUser{Arn: assumedRoleArn}},
+		}
+	}
+	events := Events{
+		webIdentity(t1.Add(2*time.Hour), "a", "arn:aws:sts::123456789123:assumed-role/prometheus/a", ""),
+		webIdentity(t1.Add(time.Hour), "b", "", ""),
+		webIdentity(t1, "a", "arn:aws:sts::123456789123:assumed-role/prometheus/a", ""),
+		webIdentity(t1, "c", "", "AccessDenied"),
+		{EventName: "GetObject", UserIdentity: UserIdentity{Arn: "arn:aws:sts::123456789123:assumed-role/prometheus/a"}},
+	}
+
+	sessions := events.Sessions()
+	require.Len(t, sessions, 2)
+	assert.Equal(t, Session{RoleSessionName: "a", AssumedRoleArn: "arn:aws:sts::123456789123:assumed-role/prometheus/a",
+		FirstSeen: t1, LastSeen: t1.Add(2 * time.Hour), Count: 2}, sessions[0])
+	// assumed role arn is derived from role arn, if response elements are missing
+	assert.Equal(t, "arn:aws:sts::123456789123:assumed-role/prometheus/b", sessions[1].AssumedRoleArn)
+
+	assert.Len(t, events.SessionEvents(sessions[0]), 1)
+	assert.Empty(t, events.SessionEvents(sessions[1]))
+}
+
+func Test_toAssumedRoleArn(t *testing.T) {
+	assert.Equal(t, "arn:aws-cn:sts::123456789123:assumed-role/test/s", toAssumedRoleArn("arn:aws-cn:iam::123456789123:role/test", "s"))
+	assert.Empty(t, toAssumedRoleArn("arn:aws:iam::123456789123:user/test", "s"))
+	assert.Empty(t, toAssumedRoleArn("invalid", "s"))
+}
+
+func TestEvents_Activity(t *testing.T) {
+	t1 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	events := Events{
+		{EventTime: t1, EventSource: "s3.amazonaws.com", EventName: "PutObject"},
+		{EventTime: t1.Add(time.Hour), EventSource: "s3.amazonaws.com", EventName: "PutObject", ErrorCode: "AccessDenied"},
+		{EventTime: t1, EventSource: "s3.amazonaws.com", EventName: "PutObject", ErrorCode: "AccessDenied"},
+		{EventTime: t1, EventSource: "aps.amazonaws.com", EventName: "RemoteWrite"},
+		{EventTime: t1, EventSource: "s3.amazonaws.com", EventName: "GetObject", ErrorMessage: "failed"},
+	}
+
+	activity := events.Activity()
+	require.Len(t, activity, 3)
+	assert.Equal(t, ActionActivity{Service: "aps", Action: "RemoteWrite", Count: 1, LastSeen: t1}, activity[0])
+	assert.Equal(t, ActionActivity{Service: "s3", Action: "GetObject", Count: 1, Errors: 1, ErrorCodes: []string{"unknown"}, LastSeen: t1}, activity[1])
+	assert.Equal(t, ActionActivity{Service: "s3", Action: "PutObject", Count: 3, Errors: 2, ErrorCodes: []string{"AccessDenied"}, LastSeen: t1.Add(time.Hour)}, activity[2])
+}
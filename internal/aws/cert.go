@@ -2,32 +2,98 @@ package aws
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/url"
+	"strings"
 	"time"
 )
 
+// Certificate is peer certificate returned in TLS handshake, fingerprints are lower case hex, the same format as IAM
+// oidc provider thumbprints
+type Certificate struct {
+	Subject           string
+	Issuer            string
+	NotBefore         time.Time
+	NotAfter          time.Time
+	FingerprintSHA1   string
+	FingerprintSHA256 string
+}
+
+// Expired returns true if the certificate is not valid at the time
+func (c Certificate) Expired(now time.Time) bool {
+	return now.After(c.NotAfter) || now.Before(c.NotBefore)
+}
+
+// ThumbprintMatch is IAM oidc provider thumbprint and certificate from the issuer chain with the same sha1
+// fingerprint, Certificate is nil if the thumbprint does not match any certificate in the chain
+type ThumbprintMatch struct {
+	Thumbprint  string
+	Certificate *Certificate
+}
+
+// MatchThumbprints matches IAM oidc provider thumbprints against issuer certificate chain
+func MatchThumbprints(thumbprints []string, chain []Certificate) []ThumbprintMatch {
+	var out []ThumbprintMatch
+	for _, thumbprint := range thumbprints {
+		match := ThumbprintMatch{Thumbprint: thumbprint}
+		for _, certificate := range chain {
+			if strings.EqualFold(thumbprint, certificate.FingerprintSHA1) {
+				match.Certificate = &certificate
+				break
+			}
+		}
+		out = append(out, match)
+	}
+	return out
+}
+
 // FingerprintSHA1 returns certificate sha1 fingerprint e.g. oidc.eks.eu-west-2.amazonaws.com
 func FingerprintSHA1(addr string, tlsSkipVerify bool) (string, error) {
-	hostAndPort, err := getHostAndPort(addr)
+	chain, err := CertificateChain(addr, tlsSkipVerify)
 	if err != nil {
 		return "", err
 	}
+	// get last certificate in the chain
+	return chain[len(chain)-1].FingerprintSHA1, nil
+}
+
+// CertificateChain returns certificates presented by the server, starting with the leaf certificate
+func CertificateChain(addr string, tlsSkipVerify bool) ([]Certificate, error) {
+	hostAndPort, err := getHostAndPort(addr)
+	if err != nil {
+		return nil, err
+	}
 
 	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", hostAndPort, &tls.Config{InsecureSkipVerify: tlsSkipVerify})
 	if err != nil {
-		return "", fmt.Errorf("tcp connection failed: %w", err)
+		return nil, fmt.Errorf("tcp connection failed: %w", err)
 	}
+	defer conn.Close()
 
 	x509Certificates := conn.ConnectionState().PeerCertificates
 	if len(x509Certificates) == 0 {
-		return "", fmt.Errorf("no certificates returned from %s", addr)
+		return nil, fmt.Errorf("no certificates returned from %s", addr)
+	}
+	var out []Certificate
+	for _, certificate := range x509Certificates {
+		out = append(out, toCertificate(certificate))
+	}
+	return out, nil
+}
+
+func toCertificate(certificate *x509.Certificate) Certificate {
+	return Certificate{
+		Subject:           certificate.Subject.String(),
+		Issuer:            certificate.Issuer.String(),
+		NotBefore:         certificate.NotBefore,
+		NotAfter:          certificate.NotAfter,
+		FingerprintSHA1:   fmt.Sprintf("%x", sha1.Sum(certificate.Raw)),
+		FingerprintSHA256: fmt.Sprintf("%x", sha256.Sum256(certificate.Raw)),
 	}
-	// get last certificate in the chain
-	fingerprint := sha1.Sum(x509Certificates[len(x509Certificates)-1].Raw)
-	return fmt.Sprintf("%x", fingerprint), nil
 }
 
 func getHostAndPort(addr string) (string, error) {
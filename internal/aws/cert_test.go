@@ -1,10 +1,18 @@
 package aws
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"math/big"
 	"testing"
+	"time"
 )
 
 func Test_getAddr(t *testing.T) {
@@ -26,3 +34,34 @@ func Test_getAddr(t *testing.T) {
 		assert.Equal(t, tc.expected, actual, fmt.Sprintf("host: %s", tc.host))
 	}
 }
+
+func Test_toCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "oidc.eks.eu-west-2.amazonaws.com"},
+		NotBefore:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	x509Certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	certificate := toCertificate(x509Certificate)
+	assert.Equal(t, "CN=oidc.eks.eu-west-2.amazonaws.com", certificate.Subject)
+	assert.Equal(t, fmt.Sprintf("%x", sha1.Sum(der)), certificate.FingerprintSHA1)
+	assert.Len(t, certificate.FingerprintSHA256, 64)
+	assert.False(t, certificate.Expired(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, certificate.Expired(time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestMatchThumbprints(t *testing.T) {
+	chain := []Certificate{{Subject: "CN=leaf", FingerprintSHA1: "aaaa"}, {Subject: "CN=root", FingerprintSHA1: "bbbb"}}
+	matches := MatchThumbprints([]string{"BBBB", "cccc"}, chain)
+	require.Len(t, matches, 2)
+	require.NotNil(t, matches[0].Certificate)
+	assert.Equal(t, "CN=root", matches[0].Certificate.Subject)
+	assert.Nil(t, matches[1].Certificate)
+}
@@ -5,35 +5,65 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/pete911/kubectl-iam4sa/internal/errs"
+	"golang.org/x/time/rate"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 )
 
-const eventsHours = 12
+const (
+	// cloudtrail lookup events is throttled at 2 requests per second per account and region
+	cloudTrailRequestsPerSecond = 2
+	iamRequestsPerSecond        = 10
+	maxRetryAttempts            = 10
+	roleSessionName             = "kubectl-iam4sa"
+)
 
+// Client is safe for concurrent use, rate limiters are shared by all copies of the client
 type Client struct {
-	logger           *slog.Logger
-	clusterName      string
-	account          string
-	region           string
-	iamClient        *iam.Client
-	cloudTrailClient *cloudtrail.Client
-	eksClient        *eks.Client
+	logger            *slog.Logger
+	clusterName       string
+	account           string
+	region            string
+	iamClient         *iam.Client
+	eventSource       EventSource
+	eksClient         *eks.Client
+	iamLimiter        *rate.Limiter
+	cfg               aws.Config
+	crossAccount      CrossAccount
+	accountIamClients *sync.Map // account id to *iam.Client with assumed cross account role
+}
+
+// Credentials select how AWS credentials are loaded, default credential chain is used if Profile is empty, RoleArn is
+// assumed with the loaded credentials if set. CrossAccount roles are assumed to inspect roles in other accounts.
+type Credentials struct {
+	Profile      string
+	RoleArn      string
+	CrossAccount CrossAccount
 }
 
-func NewClient(logger *slog.Logger, region, clusterName string) (Client, error) {
+func NewClient(logger *slog.Logger, region, clusterName string, credentials Credentials) (Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	opts := []func(*config.LoadOptions) error{config.WithRetryer(newRetryer)}
+	if credentials.Profile != "" {
+		logger.Debug(fmt.Sprintf("loading aws config with %s profile", credentials.Profile))
+		opts = append(opts, config.WithSharedConfigProfile(credentials.Profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return Client{}, err
 	}
@@ -45,62 +75,282 @@ func NewClient(logger *slog.Logger, region, clusterName string) (Client, error)
 		cfg.Region = region
 	}
 
+	if credentials.RoleArn != "" {
+		logger.Debug(fmt.Sprintf("assuming %s role", credentials.RoleArn))
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), credentials.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
 	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return Client{}, err
 	}
 	account := aws.ToString(out.Account)
+	logger.Debug(fmt.Sprintf("aws caller identity %s", aws.ToString(out.Arn)))
 
 	return Client{
-		logger:           logger,
-		clusterName:      clusterName,
-		account:          account,
-		region:           cfg.Region,
-		iamClient:        iam.NewFromConfig(cfg),
-		cloudTrailClient: cloudtrail.NewFromConfig(cfg),
-		eksClient:        eks.NewFromConfig(cfg),
+		logger:            logger,
+		clusterName:       clusterName,
+		account:           account,
+		region:            cfg.Region,
+		iamClient:         iam.NewFromConfig(cfg),
+		eventSource:       newAPIEventSource(logger, cfg),
+		eksClient:         eks.NewFromConfig(cfg),
+		iamLimiter:        rate.NewLimiter(iamRequestsPerSecond, 1),
+		cfg:               cfg,
+		crossAccount:      credentials.CrossAccount,
+		accountIamClients: &sync.Map{},
 	}, nil
 }
 
-func (c Client) GetIAMRole(roleName string) (Role, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Account returns account of the caller identity (credentials) used by the client
+func (c Client) Account() string {
+	return c.account
+}
+
+// Region returns the client region
+func (c Client) Region() string {
+	return c.region
+}
+
+// newRetryer returns retryer that retries throttled (and other retryable) requests with exponential backoff, client side
+// retry quota is disabled, because concurrent lookups would exhaust it when the API is throttling
+func newRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxRetryAttempts
+		o.RateLimiter = ratelimit.None
+	})
+}
+
+// GetIAMRole returns role, roles in other accounts are fetched with cross account role, or errs.ErrForeignAccount is
+// returned if there is no cross account role for the role account
+func (c Client) GetIAMRole(roleArn string) (Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	out, err := c.iamClient.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	account, roleName, err := parseRoleArn(roleArn)
+	if err != nil {
+		return Role{}, err
+	}
+	iamClient, err := c.iamClientFor(account)
+	if err != nil {
+		return Role{}, err
+	}
+
+	if err := c.iamLimiter.Wait(ctx); err != nil {
+		return Role{}, fmt.Errorf("role %s: %w", roleName, err)
+	}
+	out, err := iamClient.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
 	if err != nil {
-		err = handleResponseError(err, fmt.Sprintf("role %s", roleName))
+		err = handleResponseError(err, fmt.Sprintf("role %s", roleArn))
 		return Role{}, err
 	}
 	return c.toRole(out.Role), nil
 }
 
-func (c Client) LookupEvents(namespace, serviceAccount string) (Events, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetIAMRolePolicies returns attached (default version), inline and permissions boundary policies of the role
+func (c Client) GetIAMRolePolicies(role Role) (RolePolicies, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	username := fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount)
-	in := &cloudtrail.LookupEventsInput{
-		LookupAttributes: []cloudtrailtypes.LookupAttribute{{
-			AttributeKey:   cloudtrailtypes.LookupAttributeKeyUsername,
-			AttributeValue: aws.String(username),
-		}},
-		StartTime: aws.Time(time.Now().Add(-(eventsHours * time.Hour))),
+	account, _, err := parseRoleArn(role.ARN)
+	if err != nil {
+		return RolePolicies{}, err
+	}
+	iamClient, err := c.iamClientFor(account)
+	if err != nil {
+		return RolePolicies{}, err
+	}
+
+	var out RolePolicies
+	attachedIn := &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(role.Name)}
+	for {
+		if err := c.iamLimiter.Wait(ctx); err != nil {
+			return RolePolicies{}, fmt.Errorf("role %s attached policies: %w", role.Name, err)
+		}
+		list, err := iamClient.ListAttachedRolePolicies(ctx, attachedIn)
+		if err != nil {
+			return RolePolicies{}, handleResponseError(err, fmt.Sprintf("role %s attached policies", role.Name))
+		}
+		for _, attached := range list.AttachedPolicies {
+			policy, err := c.getManagedPolicy(ctx, iamClient, aws.ToString(attached.PolicyArn))
+			if err != nil {
+				return RolePolicies{}, err
+			}
+			out.Attached = append(out.Attached, policy)
+		}
+		if !list.IsTruncated {
+			break
+		}
+		attachedIn.Marker = list.Marker
 	}
 
-	var events []cloudtrailtypes.Event
+	inlineIn := &iam.ListRolePoliciesInput{RoleName: aws.String(role.Name)}
 	for {
-		out, err := c.cloudTrailClient.LookupEvents(ctx, in)
+		if err := c.iamLimiter.Wait(ctx); err != nil {
+			return RolePolicies{}, fmt.Errorf("role %s inline policies: %w", role.Name, err)
+		}
+		list, err := iamClient.ListRolePolicies(ctx, inlineIn)
 		if err != nil {
-			err = handleResponseError(err, fmt.Sprintf("events for %s user", username))
-			return nil, err
+			return RolePolicies{}, handleResponseError(err, fmt.Sprintf("role %s inline policies", role.Name))
 		}
-		events = append(events, out.Events...)
-		if aws.ToString(out.NextToken) == "" {
+		for _, policyName := range list.PolicyNames {
+			if err := c.iamLimiter.Wait(ctx); err != nil {
+				return RolePolicies{}, fmt.Errorf("role %s inline policy %s: %w", role.Name, policyName, err)
+			}
+			policy, err := iamClient.GetRolePolicy(ctx, &iam.GetRolePolicyInput{RoleName: aws.String(role.Name), PolicyName: aws.String(policyName)})
+			if err != nil {
+				return RolePolicies{}, handleResponseError(err, fmt.Sprintf("role %s inline policy %s", role.Name, policyName))
+			}
+			out.Inline = append(out.Inline, c.toPolicy(policyName, "", "", aws.ToString(policy.PolicyDocument)))
+		}
+		if !list.IsTruncated {
 			break
 		}
-		in.NextToken = out.NextToken
+		inlineIn.Marker = list.Marker
+	}
+
+	if role.PermissionsBoundaryArn != "" {
+		policy, err := c.getManagedPolicy(ctx, iamClient, role.PermissionsBoundaryArn)
+		if err != nil {
+			return RolePolicies{}, err
+		}
+		out.PermissionsBoundary = &policy
+	}
+	return out, nil
+}
+
+// getManagedPolicy returns managed policy with the default version document
+func (c Client) getManagedPolicy(ctx context.Context, iamClient *iam.Client, policyArn string) (Policy, error) {
+	if err := c.iamLimiter.Wait(ctx); err != nil {
+		return Policy{}, fmt.Errorf("policy %s: %w", policyArn, err)
+	}
+	policy, err := iamClient.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(policyArn)})
+	if err != nil {
+		return Policy{}, handleResponseError(err, fmt.Sprintf("policy %s", policyArn))
+	}
+
+	if err := c.iamLimiter.Wait(ctx); err != nil {
+		return Policy{}, fmt.Errorf("policy %s: %w", policyArn, err)
 	}
-	return c.toEvents(events), nil
+	versionId := aws.ToString(policy.Policy.DefaultVersionId)
+	version, err := iamClient.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(policyArn), VersionId: aws.String(versionId)})
+	if err != nil {
+		return Policy{}, handleResponseError(err, fmt.Sprintf("policy %s version %s", policyArn, versionId))
+	}
+	return c.toPolicy(aws.ToString(policy.Policy.PolicyName), policyArn, versionId, aws.ToString(version.PolicyVersion.Document)), nil
+}
+
+// SimulatePrincipalPolicy evaluates the request with IAM policy simulator, request context values are passed as string
+// list context entries
+func (c Client) SimulatePrincipalPolicy(roleArn string, request PermissionRequest) (Simulation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	account, _, err := parseRoleArn(roleArn)
+	if err != nil {
+		return Simulation{}, err
+	}
+	iamClient, err := c.iamClientFor(account)
+	if err != nil {
+		return Simulation{}, err
+	}
+
+	in := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(roleArn),
+		ActionNames:     []string{request.Action},
+		ResourceArns:    []string{request.Resource},
+	}
+	for key, values := range request.Context {
+		in.ContextEntries = append(in.ContextEntries, iamtypes.ContextEntry{
+			ContextKeyName:   aws.String(key),
+			ContextKeyType:   iamtypes.ContextKeyTypeEnumStringList,
+			ContextKeyValues: values,
+		})
+	}
+
+	if err := c.iamLimiter.Wait(ctx); err != nil {
+		return Simulation{}, fmt.Errorf("simulate %s policy: %w", roleArn, err)
+	}
+	out, err := iamClient.SimulatePrincipalPolicy(ctx, in)
+	if err != nil {
+		return Simulation{}, handleResponseError(err, fmt.Sprintf("simulate %s policy", roleArn))
+	}
+	if len(out.EvaluationResults) == 0 {
+		return Simulation{}, fmt.Errorf("simulate %s policy: no evaluation results", roleArn)
+	}
+	return toSimulation(out.EvaluationResults[0]), nil
+}
+
+// LookupEvents returns CloudTrail events for the service account username in the filter time window, filtered by event
+// name and source
+func (c Client) LookupEvents(namespace, serviceAccount string, filter EventsFilter) (Events, error) {
+	// larger time window can have many pages, lookup events is throttled to 2 requests per second
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount)
+	c.logger.Debug(fmt.Sprintf("lookup events for %s user, %s", username, filter))
+	attribute := cloudtrailtypes.LookupAttribute{
+		AttributeKey:   cloudtrailtypes.LookupAttributeKeyUsername,
+		AttributeValue: aws.String(username),
+	}
+	events, err := c.lookupEvents(ctx, attribute, filter)
+	if err != nil {
+		return nil, handleResponseError(err, fmt.Sprintf("events for %s user", username))
+	}
+	return events, nil
+}
+
+// LookupSessionEvents returns CloudTrail events made with the assumed role session credentials in the filter time
+// window, filtered by event name and source. CloudTrail username of assumed role events is the role session name.
+func (c Client) LookupSessionEvents(session Session, filter EventsFilter) (Events, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	c.logger.Debug(fmt.Sprintf("lookup events for %s session, %s", session.AssumedRoleArn, filter))
+	attribute := cloudtrailtypes.LookupAttribute{
+		AttributeKey:   cloudtrailtypes.LookupAttributeKeyUsername,
+		AttributeValue: aws.String(session.RoleSessionName),
+	}
+	events, err := c.lookupEvents(ctx, attribute, filter)
+	if err != nil {
+		return nil, handleResponseError(err, fmt.Sprintf("events for %s session", session.AssumedRoleArn))
+	}
+	return events.SessionEvents(session), nil
+}
+
+// LookupWebIdentityEvents returns all AssumeRoleWithWebIdentity events in the filter time window grouped by username
+// (system:serviceaccount:<namespace>:<name>). This is a single lookup, instead of a lookup per service account.
+func (c Client) LookupWebIdentityEvents(filter EventsFilter) (map[string]Events, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	c.logger.Debug(fmt.Sprintf("lookup %s events, %s", eventNameAssumeRoleWithWebIdentity, filter))
+	attribute := cloudtrailtypes.LookupAttribute{
+		AttributeKey:   cloudtrailtypes.LookupAttributeKeyEventName,
+		AttributeValue: aws.String(eventNameAssumeRoleWithWebIdentity),
+	}
+	events, err := c.lookupEvents(ctx, attribute, filter)
+	if err != nil {
+		return nil, handleResponseError(err, fmt.Sprintf("%s events", eventNameAssumeRoleWithWebIdentity))
+	}
+
+	out := make(map[string]Events)
+	for _, event := range events {
+		out[event.UserName] = append(out[event.UserName], event)
+	}
+	return out, nil
+}
+
+func (c Client) lookupEvents(ctx context.Context, attribute cloudtrailtypes.LookupAttribute, filter EventsFilter) (Events, error) {
+	events, err := c.eventSource.LookupEvents(ctx, attribute, filter)
+	if err != nil {
+		return nil, err
+	}
+	return events.Filter(filter), nil
 }
 
 func (c Client) DescribeCluster() (Cluster, error) {
@@ -115,17 +365,258 @@ func (c Client) DescribeCluster() (Cluster, error) {
 	return c.toCluster(out.Cluster), nil
 }
 
-func (c Client) GetClusterOidcProvider(clusterOidcIssuerId string) (OidcProvider, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// ClusterName returns name of the EKS cluster the client was created for
+func (c Client) ClusterName() string {
+	return c.clusterName
+}
+
+// WithClusterName returns copy of the client for the supplied cluster
+func (c Client) WithClusterName(clusterName string) Client {
+	c.clusterName = clusterName
+	return c
+}
+
+// WithEventSource returns copy of the client that looks up CloudTrail events in the supplied source
+func (c Client) WithEventSource(source EventSource) Client {
+	c.eventSource = source
+	return c
+}
+
+// FindClusterName returns name of the EKS cluster in the client region that has the supplied api server endpoint
+func (c Client) FindClusterName(endpoint string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	in := &eks.ListClustersInput{}
+	for {
+		list, err := c.eksClient.ListClusters(ctx, in)
+		if err != nil {
+			return "", handleResponseError(err, fmt.Sprintf("clusters in %s region", c.region))
+		}
+		for _, name := range list.Clusters {
+			out, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+			if err != nil {
+				return "", handleResponseError(err, fmt.Sprintf("cluster %s", name))
+			}
+			if strings.EqualFold(strings.TrimSuffix(aws.ToString(out.Cluster.Endpoint), "/"), endpoint) {
+				return name, nil
+			}
+		}
+		if aws.ToString(list.NextToken) == "" {
+			break
+		}
+		in.NextToken = list.NextToken
+	}
+	return "", errs.NewErrNotFound(fmt.Sprintf("cluster with %s endpoint in %s region: not found", endpoint, c.region))
+}
+
+// GetClusterOidcProvider returns IAM oidc provider of the cluster oidc issuer in the cluster account. If the provider is
+// not found (or the cluster account is not inspectable), providers visible to the caller are listed and matched by url.
+// Not found error contains near matching providers.
+func (c Client) GetClusterOidcProvider(cluster Cluster) (OidcProvider, error) {
+	return c.getClusterOidcProvider(cluster, func() (OidcProviderMatches, error) { return c.FindOidcProviders(cluster) })
+}
+
+// GetMatchedClusterOidcProvider is the same as GetClusterOidcProvider, but uses supplied provider matches (see
+// FindOidcProviders) instead of listing the providers again
+func (c Client) GetMatchedClusterOidcProvider(cluster Cluster, matches OidcProviderMatches) (OidcProvider, error) {
+	return c.getClusterOidcProvider(cluster, func() (OidcProviderMatches, error) { return matches, nil })
+}
+
+// getClusterOidcProvider gets oidc provider by the derived arn, findMatches is called only if it is not found
+func (c Client) getClusterOidcProvider(cluster Cluster, findMatches func() (OidcProviderMatches, error)) (OidcProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	arn := fmt.Sprintf("arn:aws:iam::%s:oidc-provider/oidc.eks.%s.amazonaws.com/id/%s", c.account, c.region, clusterOidcIssuerId)
-	out, err := c.iamClient.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: aws.String(arn)})
+	providerArn := c.clusterOidcProviderArn(cluster)
+	if iamClient, err := c.iamClientFor(arnAccount(providerArn)); err == nil {
+		provider, err := getOidcProvider(ctx, iamClient, providerArn)
+		var errNotFound *errs.ErrNotFound
+		if !errors.As(err, &errNotFound) {
+			return provider, err
+		}
+	} else {
+		var errForeignAccount *errs.ErrForeignAccount
+		if !errors.As(err, &errForeignAccount) {
+			return OidcProvider{}, err
+		}
+	}
+
+	c.logger.Debug(fmt.Sprintf("oidc provider %s not found, matching listed oidc providers", providerArn))
+	matches, err := findMatches()
+	if err != nil {
+		return OidcProvider{}, err
+	}
+	if len(matches.Exact) == 0 {
+		msg := fmt.Sprintf("oidc provider %s: not found", providerArn)
+		if len(matches.Near) != 0 {
+			msg = fmt.Sprintf("%s, near matches: %s", msg, strings.Join(matches.Near, ", "))
+		}
+		return OidcProvider{}, errs.NewErrNotFound(msg)
+	}
+	iamClient, err := c.iamClientFor(arnAccount(matches.Exact[0]))
 	if err != nil {
-		err = handleResponseError(err, fmt.Sprintf("oidc provider %s", arn))
 		return OidcProvider{}, err
 	}
-	return toOidcProvider(out, arn), nil
+	return getOidcProvider(ctx, iamClient, matches.Exact[0])
+}
+
+// FindOidcProviders lists oidc providers in the caller account and in the cluster account (if it is inspectable), and
+// matches them against the cluster oidc issuer
+func (c Client) FindOidcProviders(cluster Cluster) (OidcProviderMatches, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accounts := []string{c.account}
+	if account := arnAccount(c.clusterOidcProviderArn(cluster)); account != c.account {
+		accounts = append(accounts, account)
+	}
+
+	var providerArns []string
+	for _, account := range accounts {
+		iamClient, err := c.iamClientFor(account)
+		if err != nil {
+			c.logger.Debug(fmt.Sprintf("list oidc providers in %s account: %v", account, err))
+			continue
+		}
+		arns, err := listOidcProviderArns(ctx, iamClient)
+		if err != nil {
+			return OidcProviderMatches{}, handleResponseError(err, fmt.Sprintf("list oidc providers in %s account", account))
+		}
+		providerArns = append(providerArns, arns...)
+	}
+	return MatchOidcProviders(cluster.OidcIssuerHost(), providerArns), nil
+}
+
+// ListOidcProviderArns returns arns of IAM oidc providers in the caller account
+func (c Client) ListOidcProviderArns() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := listOidcProviderArns(ctx, c.iamClient)
+	if err != nil {
+		return nil, handleResponseError(err, fmt.Sprintf("list oidc providers in %s account", c.account))
+	}
+	return out, nil
+}
+
+func listOidcProviderArns(ctx context.Context, iamClient *iam.Client) ([]string, error) {
+	out, err := iamClient.ListOpenIDConnectProviders(ctx, &iam.ListOpenIDConnectProvidersInput{})
+	if err != nil {
+		return nil, err
+	}
+	var providerArns []string
+	for _, provider := range out.OpenIDConnectProviderList {
+		providerArns = append(providerArns, aws.ToString(provider.Arn))
+	}
+	return providerArns, nil
+}
+
+// ListIAMRoles returns all roles in the caller account, RoleLastUsed is not set (it is not returned by ListRoles)
+func (c Client) ListIAMRoles() ([]Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var out []Role
+	in := &iam.ListRolesInput{}
+	for {
+		if err := c.iamLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("list roles: %w", err)
+		}
+		list, err := c.iamClient.ListRoles(ctx, in)
+		if err != nil {
+			return nil, handleResponseError(err, fmt.Sprintf("list roles in %s account", c.account))
+		}
+		for _, role := range list.Roles {
+			out = append(out, c.toRole(&role))
+		}
+		if !list.IsTruncated {
+			break
+		}
+		in.Marker = list.Marker
+	}
+	return out, nil
+}
+
+// ListClusters returns all EKS clusters in the client region
+func (c Client) ListClusters() ([]Cluster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var out []Cluster
+	in := &eks.ListClustersInput{}
+	for {
+		list, err := c.eksClient.ListClusters(ctx, in)
+		if err != nil {
+			return nil, handleResponseError(err, fmt.Sprintf("clusters in %s region", c.region))
+		}
+		for _, name := range list.Clusters {
+			cluster, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+			if err != nil {
+				return nil, handleResponseError(err, fmt.Sprintf("cluster %s", name))
+			}
+			out = append(out, c.toCluster(cluster.Cluster))
+		}
+		if aws.ToString(list.NextToken) == "" {
+			break
+		}
+		in.NextToken = list.NextToken
+	}
+	return out, nil
+}
+
+// clusterOidcProviderArn returns oidc provider arn in the cluster account, partition and account are taken from the
+// caller if the cluster arn is not available
+func (c Client) clusterOidcProviderArn(cluster Cluster) string {
+	if providerArn := cluster.OidcProviderArn(); providerArn != "" {
+		return providerArn
+	}
+	return oidcProviderArn(partitionForRegion(c.region), c.account, cluster.OidcIssuerHost())
+}
+
+func getOidcProvider(ctx context.Context, iamClient *iam.Client, providerArn string) (OidcProvider, error) {
+	out, err := iamClient.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: aws.String(providerArn)})
+	if err != nil {
+		return OidcProvider{}, handleResponseError(err, fmt.Sprintf("oidc provider %s", providerArn))
+	}
+	return toOidcProvider(out, providerArn), nil
+}
+
+// ListPodIdentityAssociations returns EKS Pod Identity associations for the cluster, all namespaces if namespace is empty
+func (c Client) ListPodIdentityAssociations(namespace string) ([]PodIdentityAssociation, error) {
+	// list and describe call for each association share the context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	in := &eks.ListPodIdentityAssociationsInput{ClusterName: aws.String(c.clusterName)}
+	if namespace != "" {
+		in.Namespace = aws.String(namespace)
+	}
+
+	var out []PodIdentityAssociation
+	for {
+		list, err := c.eksClient.ListPodIdentityAssociations(ctx, in)
+		if err != nil {
+			return nil, handleResponseError(err, fmt.Sprintf("pod identity associations for %s cluster", c.clusterName))
+		}
+		// list returns only summary, role arn is set only in describe response
+		for _, summary := range list.Associations {
+			association, err := c.eksClient.DescribePodIdentityAssociation(ctx, &eks.DescribePodIdentityAssociationInput{
+				ClusterName:   aws.String(c.clusterName),
+				AssociationId: summary.AssociationId,
+			})
+			if err != nil {
+				return nil, handleResponseError(err, fmt.Sprintf("pod identity association %s", aws.ToString(summary.AssociationId)))
+			}
+			out = append(out, toPodIdentityAssociation(association.Association))
+		}
+		if aws.ToString(list.NextToken) == "" {
+			break
+		}
+		in.NextToken = list.NextToken
+	}
+	return out, nil
 }
 
 // handleResponseError converts error to custom error (if possible) to make handling of errors easier
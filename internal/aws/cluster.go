@@ -1,7 +1,9 @@
 package aws
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/eks/types"
 	"strings"
 	"time"
@@ -22,20 +24,57 @@ func (c Cluster) OidcIssuerFingerprint() (string, error) {
 	return FingerprintSHA1(c.OidcIssuer, false)
 }
 
-func (c Cluster) OidcIssuerId() string {
-	parts := strings.Split(c.OidcIssuer, "/")
-	return parts[len(parts)-1]
+// OidcIssuerHost returns oidc issuer without scheme, e.g. oidc.eks.eu-west-2.amazonaws.com/id/abcxyz123, this is
+// the form used in IAM oidc provider url and in trust policy condition keys
+func (c Cluster) OidcIssuerHost() string {
+	return strings.TrimPrefix(c.OidcIssuer, "https://")
+}
+
+// OidcProviderArn returns IAM oidc provider arn for the cluster oidc issuer, in the cluster account
+func (c Cluster) OidcProviderArn() string {
+	clusterArn, err := arn.Parse(c.Arn)
+	if err != nil {
+		return ""
+	}
+	return oidcProviderArn(clusterArn.Partition, clusterArn.AccountID, c.OidcIssuerHost())
+}
+
+// oidcProviderArn returns oidc provider arn, issuer host already contains partition DNS suffix, e.g.
+// oidc.eks.cn-north-1.amazonaws.com.cn/id/abc
+func oidcProviderArn(partition, account, issuerHost string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", partition, account, issuerHost)
+}
+
+// partitionForRegion returns AWS partition of the region, used when cluster arn is not available
+func partitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	}
+	return "aws"
 }
 
 func (c Client) toCluster(cluster *types.Cluster) Cluster {
-	return Cluster{
-		Arn:         aws.ToString(cluster.Arn),
-		Name:        aws.ToString(cluster.Name),
-		Certificate: aws.ToString(cluster.CertificateAuthority.Data),
-		CreatedAt:   aws.ToTime(cluster.CreatedAt),
-		Endpoint:    aws.ToString(cluster.Endpoint),
-		OidcIssuer:  aws.ToString(cluster.Identity.Oidc.Issuer),
-		RoleArn:     aws.ToString(cluster.RoleArn),
-		Status:      string(cluster.Status),
+	out := Cluster{
+		Arn:       aws.ToString(cluster.Arn),
+		Name:      aws.ToString(cluster.Name),
+		CreatedAt: aws.ToTime(cluster.CreatedAt),
+		Endpoint:  aws.ToString(cluster.Endpoint),
+		RoleArn:   aws.ToString(cluster.RoleArn),
+		Status:    string(cluster.Status),
+	}
+	// certificate and identity are not set while the cluster is being created
+	if cluster.CertificateAuthority != nil {
+		out.Certificate = aws.ToString(cluster.CertificateAuthority.Data)
+	}
+	if cluster.Identity != nil && cluster.Identity.Oidc != nil {
+		out.OidcIssuer = aws.ToString(cluster.Identity.Oidc.Issuer)
 	}
+	return out
 }
@@ -0,0 +1,187 @@
+package aws
+
+import (
+	"cmp"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conditionMatches evaluates condition operator (e.g. StringEquals) with policy values against request values.
+// Request values are empty if the condition key is not present in the request. Returns false for supported
+// if the operator is not supported, in which case match should be ignored.
+func conditionMatches(operator string, policyValues, requestValues []string) (match, supported bool) {
+	// Null checks only presence of the key, true means the key is not present
+	if operator == "Null" {
+		return matchAny(policyValues, strconv.FormatBool(len(requestValues) == 0), strings.EqualFold), true
+	}
+
+	operator, ifExists := strings.CutSuffix(operator, "IfExists")
+	if ifExists && len(requestValues) == 0 {
+		return true, true
+	}
+
+	// set operators, ForAnyValue is the default for single valued keys
+	forAllValues := false
+	if v, ok := strings.CutPrefix(operator, "ForAllValues:"); ok {
+		operator, forAllValues = v, true
+	}
+	operator = strings.TrimPrefix(operator, "ForAnyValue:")
+
+	matchValue, negated, supported := conditionOperator(operator)
+	if !supported {
+		return false, false
+	}
+	if len(requestValues) == 0 {
+		// missing key matches only negated operators (and ForAllValues, which is true for empty set)
+		return negated || forAllValues, true
+	}
+
+	matches := 0
+	for _, requestValue := range requestValues {
+		if matchAny(policyValues, requestValue, matchValue) != negated {
+			matches++
+		}
+	}
+	if forAllValues {
+		return matches == len(requestValues), true
+	}
+	return matches > 0, true
+}
+
+// conditionOperator returns match function for condition operator and whether the operator is negated
+func conditionOperator(operator string) (match func(pattern, value string) bool, negated, supported bool) {
+	switch operator {
+	case "StringEquals":
+		return equals, false, true
+	case "StringNotEquals":
+		return equals, true, true
+	case "StringEqualsIgnoreCase":
+		return strings.EqualFold, false, true
+	case "StringNotEqualsIgnoreCase":
+		return strings.EqualFold, true, true
+	case "StringLike":
+		return matchWildcard, false, true
+	case "StringNotLike":
+		return matchWildcard, true, true
+	case "NumericEquals":
+		return compareNumeric(func(c int) bool { return c == 0 }), false, true
+	case "NumericNotEquals":
+		return compareNumeric(func(c int) bool { return c == 0 }), true, true
+	case "NumericLessThan":
+		return compareNumeric(func(c int) bool { return c > 0 }), false, true
+	case "NumericLessThanEquals":
+		return compareNumeric(func(c int) bool { return c >= 0 }), false, true
+	case "NumericGreaterThan":
+		return compareNumeric(func(c int) bool { return c < 0 }), false, true
+	case "NumericGreaterThanEquals":
+		return compareNumeric(func(c int) bool { return c <= 0 }), false, true
+	case "DateEquals":
+		return compareDate(func(c int) bool { return c == 0 }), false, true
+	case "DateNotEquals":
+		return compareDate(func(c int) bool { return c == 0 }), true, true
+	case "DateLessThan":
+		return compareDate(func(c int) bool { return c > 0 }), false, true
+	case "DateLessThanEquals":
+		return compareDate(func(c int) bool { return c >= 0 }), false, true
+	case "DateGreaterThan":
+		return compareDate(func(c int) bool { return c < 0 }), false, true
+	case "DateGreaterThanEquals":
+		return compareDate(func(c int) bool { return c <= 0 }), false, true
+	case "Bool":
+		return strings.EqualFold, false, true
+	case "IpAddress":
+		return matchIpAddress, false, true
+	case "NotIpAddress":
+		return matchIpAddress, true, true
+	case "ArnEquals", "ArnLike":
+		return matchArn, false, true
+	case "ArnNotEquals", "ArnNotLike":
+		return matchArn, true, true
+	}
+	return nil, false, false
+}
+
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchArn matches each of the six arn components separately, so wildcard does not match across ':' separators,
+// resource component (the last one) can contain ':'
+func matchArn(pattern, value string) bool {
+	patternParts, valueParts := strings.SplitN(pattern, ":", 6), strings.SplitN(value, ":", 6)
+	if len(patternParts) != 6 || len(valueParts) != 6 {
+		return false
+	}
+	for i := range patternParts {
+		if !matchWildcard(patternParts[i], valueParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equals(a, b string) bool {
+	return a == b
+}
+
+// compareNumeric returns match function that compares policy value with request value, test receives -1, 0 or 1 as
+// the result of comparing policy value to request value. Values that are not numbers do not match.
+func compareNumeric(test func(int) bool) func(pattern, value string) bool {
+	return func(pattern, value string) bool {
+		p, err := strconv.ParseFloat(pattern, 64)
+		if err != nil {
+			return false
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		return test(cmp.Compare(p, v))
+	}
+}
+
+// compareDate is the same as compareNumeric, but for dates in RFC3339 (or date only) format, or epoch seconds
+func compareDate(test func(int) bool) func(pattern, value string) bool {
+	return func(pattern, value string) bool {
+		p, ok := parseConditionDate(pattern)
+		if !ok {
+			return false
+		}
+		v, ok := parseConditionDate(value)
+		if !ok {
+			return false
+		}
+		return test(p.Compare(v))
+	}
+}
+
+func parseConditionDate(value string) (time.Time, bool) {
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(epoch, 0), true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// matchIpAddress matches request ip address against policy ip address or CIDR block
+func matchIpAddress(pattern, value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(pattern))
+}
@@ -0,0 +1,62 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// OidcDiscovery is oidc issuer discovery document
+type OidcDiscovery struct {
+	Issuer                           string   `json:"issuer"`
+	JwksUri                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// DiscoveryUrl returns oidc discovery document url for the issuer
+func DiscoveryUrl(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + discoveryPath
+}
+
+// GetOidcDiscovery fetches oidc discovery document from the issuer
+func GetOidcDiscovery(issuer string) (OidcDiscovery, error) {
+	var out OidcDiscovery
+	if err := getJSON(DiscoveryUrl(issuer), &out); err != nil {
+		return OidcDiscovery{}, err
+	}
+	return out, nil
+}
+
+// GetJWKS fetches JSON web key set from the jwks uri (discovery document jwks_uri)
+func GetJWKS(jwksUri string) (JWKS, error) {
+	var out JWKS
+	if err := getJSON(jwksUri, &out); err != nil {
+		return JWKS{}, err
+	}
+	return out, nil
+}
+
+func getJSON(url string, v any) error {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", url, err)
+	}
+	return nil
+}
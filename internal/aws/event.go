@@ -1,19 +1,84 @@
 package aws
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"slices"
+	"strings"
 	"time"
 )
 
+const DefaultEventsWindow = 12 * time.Hour
+
+// EventsFilter is CloudTrail lookup time window and event filters. CloudTrail lookup allows only one lookup attribute
+// (service account username), event names and sources are filtered on the client side.
+type EventsFilter struct {
+	StartTime    time.Time
+	EndTime      time.Time // now if not set
+	EventNames   []string  // all event names if empty
+	EventSources []string  // all event sources if empty
+}
+
+// EventsStartTime returns start of the time window, if start is not set, the window (since) ends at end time, or now
+// if end is not set either
+func EventsStartTime(start, end time.Time, since time.Duration, now time.Time) time.Time {
+	if !start.IsZero() {
+		return start
+	}
+	if !end.IsZero() {
+		return end.Add(-since)
+	}
+	return now.Add(-since)
+}
+
+// Match returns true if the event matches event name and event source filter (time window is applied by lookup)
+func (f EventsFilter) Match(event Event) bool {
+	if len(f.EventNames) != 0 && !slices.ContainsFunc(f.EventNames, func(v string) bool { return strings.EqualFold(v, event.EventName) }) {
+		return false
+	}
+	if len(f.EventSources) != 0 && !slices.ContainsFunc(f.EventSources, func(v string) bool { return strings.EqualFold(v, event.EventSource) }) {
+		return false
+	}
+	return true
+}
+
+func (f EventsFilter) String() string {
+	end := "now"
+	if !f.EndTime.IsZero() {
+		end = f.EndTime.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("start: %s end: %s event names: %v event sources: %v", f.StartTime.Format(time.RFC3339), end, f.EventNames, f.EventSources)
+}
+
+const eventNameAssumeRoleWithWebIdentity = "AssumeRoleWithWebIdentity"
+
 type Events []Event
 
 func (e Events) FailedEvents() Events {
 	var out Events
 	for _, event := range e {
-		if event.ErrorMessage != "" || event.ErrorCode != "" {
+		if event.Failed() {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// Filter returns events that match the filter
+func (e Events) Filter(filter EventsFilter) Events {
+	var out Events
+	for _, event := range e {
+		if filter.Match(event) {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// WebIdentityEvents returns only AssumeRoleWithWebIdentity events
+func (e Events) WebIdentityEvents() Events {
+	var out Events
+	for _, event := range e {
+		if event.EventName == eventNameAssumeRoleWithWebIdentity {
 			out = append(out, event)
 		}
 	}
@@ -33,13 +98,24 @@ type Event struct {
 	SourceIP          string            `json:"sourceIPAddress"`
 	UserAgent         string            `json:"userAgent"`
 	RequestParameters RequestParameters `json:"requestParameters"`
+	ResponseElements  ResponseElements  `json:"responseElements"`
+	Resources         []EventResource   `json:"resources"`
 	RequestId         string            `json:"requestId"`
 	EventType         string            `json:"eventType"`
+	// RecipientAccountId is account that received the event, used to build resource arns
+	RecipientAccountId string `json:"recipientAccountId"`
+}
+
+// Failed returns true if the event has error code or error message
+func (e Event) Failed() bool {
+	return e.ErrorMessage != "" || e.ErrorCode != ""
 }
 
 type UserIdentity struct {
 	Type             string `json:"type"`
 	PrincipalId      string `json:"principalId"`
+	Arn              string `json:"arn"`
+	AccessKeyId      string `json:"accessKeyId"`
 	UserName         string `json:"userName"`
 	IdentityProvider string `json:"identityProvider"`
 }
@@ -49,21 +125,20 @@ type RequestParameters struct {
 	RoleSessionName string `json:"roleSessionName"`
 }
 
-func (c Client) toEvents(events []types.Event) Events {
-	var out []Event
-	for _, e := range events {
-		// set these fields from response, if json unmarshal fails, at least we have some info
-		event := Event{
-			EventTime:   aws.ToTime(e.EventTime),
-			EventId:     aws.ToString(e.EventId),
-			EventSource: aws.ToString(e.EventSource),
-			EventName:   aws.ToString(e.EventName),
-			UserName:    aws.ToString(e.Username),
-		}
-		if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &event); err != nil {
-			c.logger.Warn(fmt.Sprintf("unmrshal %s event: %v", event.EventId, err))
-		}
-		out = append(out, event)
-	}
-	return out
+// EventResource is resource accessed by the API call, CloudTrail records resources only for some events
+type EventResource struct {
+	ARN       string `json:"ARN"`
+	AccountId string `json:"accountId"`
+	Type      string `json:"type"`
+}
+
+// ResponseElements are AssumeRoleWithWebIdentity response elements, other events have different response elements
+// that are not unmarshalled
+type ResponseElements struct {
+	AssumedRoleUser AssumedRoleUser `json:"assumedRoleUser"`
+}
+
+type AssumedRoleUser struct {
+	Arn           string `json:"arn"`
+	AssumedRoleId string `json:"assumedRoleId"`
 }
@@ -0,0 +1,34 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEventsFilter_Match(t *testing.T) {
+	event := Event{EventName: "AssumeRoleWithWebIdentity", EventSource: "sts.amazonaws.com"}
+	tcs := []struct {
+		filter   EventsFilter
+		expected bool
+	}{
+		{EventsFilter{}, true},
+		{EventsFilter{EventNames: []string{"assumerolewithwebidentity"}}, true},
+		{EventsFilter{EventNames: []string{"AssumeRole"}}, false},
+		{EventsFilter{EventSources: []string{"sts.amazonaws.com"}}, true},
+		{EventsFilter{EventNames: []string{"AssumeRoleWithWebIdentity"}, EventSources: []string{"s3.amazonaws.com"}}, false},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, tc.filter.Match(event), "filter: %s", tc.filter)
+	}
+}
+
+func TestEventsStartTime(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	start, end := now.AddDate(0, 0, -7), now.AddDate(0, 0, -2)
+
+	assert.Equal(t, now.Add(-12*time.Hour), EventsStartTime(time.Time{}, time.Time{}, 12*time.Hour, now))
+	assert.Equal(t, end.Add(-12*time.Hour), EventsStartTime(time.Time{}, end, 12*time.Hour, now))
+	assert.Equal(t, start, EventsStartTime(start, end, 12*time.Hour, now))
+}
@@ -0,0 +1,331 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"golang.org/x/time/rate"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSource returns CloudTrail events that match the lookup attribute in the filter time window (latest first),
+// event name and source filters are applied by the client
+type EventSource interface {
+	LookupEvents(ctx context.Context, attribute cloudtrailtypes.LookupAttribute, filter EventsFilter) (Events, error)
+}
+
+// ObservesDataEvents returns false if the client looks up events by LookupEvents API, which does not return data events
+// (e.g. s3:GetObject, dynamodb:GetItem, sqs:SendMessage). Local files and event data stores can have data events.
+func (c Client) ObservesDataEvents() bool {
+	_, ok := c.eventSource.(apiEventSource)
+	return !ok
+}
+
+// ObservesResources returns false if the client looks up events in CloudTrail Lake event data store, event resources
+// are not mapped from query results, so observed permissions have "*" resource
+func (c Client) ObservesResources() bool {
+	_, ok := c.eventSource.(lakeEventSource)
+	return !ok
+}
+
+// apiEventSource is CloudTrail LookupEvents API, it returns only management events from the past 90 days
+type apiEventSource struct {
+	logger  *slog.Logger
+	client  *cloudtrail.Client
+	limiter *rate.Limiter
+}
+
+func newAPIEventSource(logger *slog.Logger, cfg aws.Config) apiEventSource {
+	return apiEventSource{
+		logger:  logger,
+		client:  cloudtrail.NewFromConfig(cfg),
+		limiter: rate.NewLimiter(cloudTrailRequestsPerSecond, 1),
+	}
+}
+
+func (s apiEventSource) LookupEvents(ctx context.Context, attribute cloudtrailtypes.LookupAttribute, filter EventsFilter) (Events, error) {
+	in := &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{attribute},
+		StartTime:        aws.Time(filter.StartTime),
+	}
+	if !filter.EndTime.IsZero() {
+		in.EndTime = aws.Time(filter.EndTime)
+	}
+
+	var events []cloudtrailtypes.Event
+	for {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		out, err := s.client.LookupEvents(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, out.Events...)
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	return toEvents(s.logger, events), nil
+}
+
+// fileEventSource reads CloudTrail log files as delivered to S3 (optionally gzipped {"Records":[...]} objects), JSONL
+// files with one record per line, or LookupEvents API output ({"Events":[...]} or events with CloudTrailEvent field).
+// Path is either a file or a directory that is read recursively. Files are read once, on the first lookup.
+type fileEventSource struct {
+	logger *slog.Logger
+	path   string
+	once   sync.Once
+	events Events
+	err    error
+}
+
+// NewFileEventSource returns event source that reads CloudTrail events from local file or directory
+func NewFileEventSource(logger *slog.Logger, path string) EventSource {
+	return &fileEventSource{logger: logger, path: path}
+}
+
+func (s *fileEventSource) LookupEvents(_ context.Context, attribute cloudtrailtypes.LookupAttribute, filter EventsFilter) (Events, error) {
+	s.once.Do(func() {
+		s.events, s.err = readEventFiles(s.logger, s.path)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	match, err := attributeMatcher(attribute)
+	if err != nil {
+		return nil, err
+	}
+	var out Events
+	for _, event := range s.events {
+		if match(event) && inTimeWindow(event, filter) {
+			out = append(out, event)
+		}
+	}
+	return out, nil
+}
+
+// attributeMatcher returns function that matches events against lookup attribute, the same way LookupEvents does
+func attributeMatcher(attribute cloudtrailtypes.LookupAttribute) (func(Event) bool, error) {
+	value := aws.ToString(attribute.AttributeValue)
+	switch attribute.AttributeKey {
+	case cloudtrailtypes.LookupAttributeKeyUsername:
+		return func(e Event) bool { return e.UserName == value }, nil
+	case cloudtrailtypes.LookupAttributeKeyEventName:
+		return func(e Event) bool { return e.EventName == value }, nil
+	case cloudtrailtypes.LookupAttributeKeyEventSource:
+		return func(e Event) bool { return e.EventSource == value }, nil
+	case cloudtrailtypes.LookupAttributeKeyEventId:
+		return func(e Event) bool { return e.EventId == value }, nil
+	case cloudtrailtypes.LookupAttributeKeyAccessKeyId:
+		return func(e Event) bool { return e.UserIdentity.AccessKeyId == value }, nil
+	}
+	return nil, fmt.Errorf("unsupported lookup attribute %s", attribute.AttributeKey)
+}
+
+func inTimeWindow(event Event, filter EventsFilter) bool {
+	if event.EventTime.Before(filter.StartTime) {
+		return false
+	}
+	return filter.EndTime.IsZero() || !event.EventTime.After(filter.EndTime)
+}
+
+// readEventFiles reads events from the file, or from all files in the directory, sorted by event time (latest first)
+func readEventFiles(logger *slog.Logger, path string) (Events, error) {
+	var out Events
+	err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		events, err := readEventFile(logger, name)
+		if err != nil {
+			return fmt.Errorf("read events from %s: %w", name, err)
+		}
+		logger.Debug(fmt.Sprintf("read %d events from %s", len(events), name))
+		out = append(out, events...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(out, func(a, b Event) int { return b.EventTime.Compare(a.EventTime) })
+	return out, nil
+}
+
+func readEventFile(logger *slog.Logger, name string) (Events, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	return parseEventRecords(logger, r)
+}
+
+// decompress returns gzip reader if the content is gzipped (S3 delivered CloudTrail logs), or the supplied reader
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// parseEventRecords parses stream of JSON objects, object is either CloudTrail log file ({"Records":[...]}), single
+// event record (JSONL), LookupEvents API event with CloudTrailEvent field, or LookupEvents output ({"Events":[...]}).
+// Objects that are none of these are rejected.
+func parseEventRecords(logger *slog.Logger, r io.Reader) (Events, error) {
+	var out Events
+	decoder := json.NewDecoder(r)
+	for {
+		var object struct {
+			Records []json.RawMessage `json:"Records"`
+			Events  []struct {
+				CloudTrailEvent string `json:"CloudTrailEvent"`
+			} `json:"Events"`
+			CloudTrailEvent *string `json:"CloudTrailEvent"`
+			EventId         string  `json:"eventID"`
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, err
+		}
+
+		var records []json.RawMessage
+		switch {
+		case object.Records != nil:
+			records = object.Records
+		case object.Events != nil:
+			for _, event := range object.Events {
+				records = append(records, json.RawMessage(event.CloudTrailEvent))
+			}
+		case object.CloudTrailEvent != nil:
+			records = []json.RawMessage{json.RawMessage(*object.CloudTrailEvent)}
+		case object.EventId != "":
+			records = []json.RawMessage{raw}
+		default:
+			return nil, errors.New("object is not CloudTrail log file, event record or LookupEvents output")
+		}
+		for _, record := range records {
+			event, err := parseEventRecord(record)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("unmarshal %s event: %v", event.EventId, err))
+				// record is not an event, if even the event id cannot be read
+				if event.EventId == "" {
+					continue
+				}
+			}
+			out = append(out, event)
+		}
+	}
+}
+
+// eventRecord are CloudTrail event record fields that are returned separately by LookupEvents API
+type eventRecord struct {
+	EventTime   time.Time `json:"eventTime"`
+	EventId     string    `json:"eventID"`
+	EventSource string    `json:"eventSource"`
+	EventName   string    `json:"eventName"`
+}
+
+// parseEventRecord parses CloudTrail event record, username is set the same way as LookupEvents API does it (user
+// name of the identity, or session name of the assumed role)
+func parseEventRecord(record []byte) (Event, error) {
+	var header eventRecord
+	if err := json.Unmarshal(record, &header); err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		EventTime:   header.EventTime,
+		EventId:     header.EventId,
+		EventSource: header.EventSource,
+		EventName:   header.EventName,
+	}
+	err := json.Unmarshal(record, &event)
+	event.UserName = eventUsername(event.UserIdentity)
+	return event, err
+}
+
+// eventUsername returns identity user name, or session name for assumed role identity
+func eventUsername(identity UserIdentity) string {
+	if identity.UserName != "" {
+		return identity.UserName
+	}
+	if identity.Type == "AssumedRole" {
+		if i := strings.LastIndex(identity.Arn, "/"); i != -1 {
+			return identity.Arn[i+1:]
+		}
+	}
+	return ""
+}
+
+// toEvents returns events from LookupEvents API response, event fields are set from the response and from the
+// CloudTrailEvent record, if the record cannot be unmarshalled, at least response fields are set. Resources are set from
+// the response resources, because management event records rarely have resources.
+func toEvents(logger *slog.Logger, events []cloudtrailtypes.Event) Events {
+	var out Events
+	for _, e := range events {
+		event := Event{
+			EventTime:   aws.ToTime(e.EventTime),
+			EventId:     aws.ToString(e.EventId),
+			EventSource: aws.ToString(e.EventSource),
+			EventName:   aws.ToString(e.EventName),
+			UserName:    aws.ToString(e.Username),
+		}
+		if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &event); err != nil {
+			logger.Warn(fmt.Sprintf("unmarshal %s event: %v", event.EventId, err))
+		}
+		event.Resources = appendResources(event, e.Resources)
+		out = append(out, event)
+	}
+	return out
+}
+
+// appendResources returns event resources with LookupEvents response resources that are not in the event already,
+// resources without arn (unknown resource type) are skipped
+func appendResources(event Event, resources []cloudtrailtypes.Resource) []EventResource {
+	out := event.Resources
+	for _, resource := range resources {
+		resourceType := aws.ToString(resource.ResourceType)
+		arn := resourceArn(resourceType, aws.ToString(resource.ResourceName), event)
+		if arn == "" || slices.ContainsFunc(out, func(r EventResource) bool { return r.ARN == arn }) {
+			continue
+		}
+		out = append(out, EventResource{ARN: arn, AccountId: event.RecipientAccountId, Type: resourceType})
+	}
+	return out
+}
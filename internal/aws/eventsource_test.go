@@ -0,0 +1,125 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	webIdentityRecord = `{"eventVersion":"1.08","userIdentity":{"type":"WebIdentityUser","principalId":"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/abc:sts.amazonaws.com:system:serviceaccount:default:app","userName":"system:serviceaccount:default:app","identityProvider":"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/abc"},"eventTime":"2026-01-01T10:00:00Z","eventSource":"sts.amazonaws.com","eventName":"AssumeRoleWithWebIdentity","awsRegion":"eu-west-2","requestParameters":{"roleArn":"arn:aws:iam::123456789123:role/app","roleSessionName":"session-1"},"responseElements":{"assumedRoleUser":{"assumedRoleId":"AROA:session-1","arn":"arn:aws:sts::123456789123:assumed-role/app/session-1"}},"eventID":"event-1"}`
+	assumedRoleRecord = `{"userIdentity":{"type":"AssumedRole","arn":"arn:aws:sts::123456789123:assumed-role/app/session-1","accessKeyId":"ASIA1"},"eventTime":"2026-01-01T11:00:00Z","eventSource":"s3.amazonaws.com","eventName":"GetObject","resources":[{"ARN":"arn:aws:s3:::bucket/key","type":"AWS::S3::Object"}],"eventID":"event-2"}`
+)
+
+func TestToEvents(t *testing.T) {
+	events := toEvents(slog.Default(), []cloudtrailtypes.Event{
+		{
+			EventId:         aws.String("event-1"),
+			EventName:       aws.String("AssumeRoleWithWebIdentity"),
+			EventSource:     aws.String("sts.amazonaws.com"),
+			EventTime:       aws.Time(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)),
+			Username:        aws.String("system:serviceaccount:default:app"),
+			CloudTrailEvent: aws.String(webIdentityRecord),
+		},
+		{EventId: aws.String("event-3"), EventName: aws.String("GetObject"), CloudTrailEvent: aws.String("invalid")},
+		{
+			EventId:         aws.String("event-4"),
+			EventName:       aws.String("PutBucketTagging"),
+			CloudTrailEvent: aws.String(`{"awsRegion":"cn-north-1","recipientAccountId":"123456789123"}`),
+			Resources: []cloudtrailtypes.Resource{
+				{ResourceType: aws.String("AWS::S3::Bucket"), ResourceName: aws.String("bucket")},
+				{ResourceType: aws.String("AWS::SNS::Topic"), ResourceName: aws.String("arn:aws-cn:sns:cn-north-1:123456789123:topic")},
+				{ResourceType: aws.String("AWS::Unknown::Type"), ResourceName: aws.String("name")},
+			},
+		},
+	})
+
+	require.Len(t, events, 3)
+	assert.Equal(t, "system:serviceaccount:default:app", events[0].UserName)
+	assert.Equal(t, "session-1", events[0].RequestParameters.RoleSessionName)
+	assert.Equal(t, "arn:aws:sts::123456789123:assumed-role/app/session-1", events[0].ResponseElements.AssumedRoleUser.Arn)
+	// response fields are set, even if the record is invalid
+	assert.Equal(t, "event-3", events[1].EventId)
+	assert.Equal(t, "GetObject", events[1].EventName)
+	assert.Equal(t, []string{"arn:aws-cn:s3:::bucket", "arn:aws-cn:sns:cn-north-1:123456789123:topic"}, events[2].ResourceArns())
+}
+
+func TestParseEventRecords(t *testing.T) {
+	lookupOutput, err := json.Marshal(map[string]string{"EventId": "event-1", "CloudTrailEvent": webIdentityRecord})
+	require.NoError(t, err)
+	lookupEventsOutput, err := json.Marshal(map[string][]map[string]string{"Events": {
+		{"EventId": "event-1", "CloudTrailEvent": webIdentityRecord},
+		{"EventId": "event-2", "CloudTrailEvent": assumedRoleRecord},
+	}})
+	require.NoError(t, err)
+	tcs := []struct {
+		name    string
+		content string
+	}{
+		{"log file", `{"Records":[` + webIdentityRecord + `,` + assumedRoleRecord + `]}`},
+		{"jsonl", webIdentityRecord + "\n" + assumedRoleRecord + "\n"},
+		{"lookup events event", string(lookupOutput) + "\n" + assumedRoleRecord},
+		{"lookup events output", string(lookupEventsOutput)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := parseEventRecords(slog.Default(), strings.NewReader(tc.content))
+			require.NoError(t, err)
+			require.Len(t, events, 2)
+			assert.Equal(t, "event-1", events[0].EventId)
+			assert.Equal(t, time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), events[0].EventTime)
+			assert.Equal(t, "system:serviceaccount:default:app", events[0].UserName)
+			assert.Equal(t, "session-1", events[1].UserName)
+			assert.Equal(t, []string{"arn:aws:s3:::bucket/key"}, events[1].ResourceArns())
+		})
+	}
+	t.Run("unrecognised object", func(t *testing.T) {
+		_, err := parseEventRecords(slog.Default(), strings.NewReader(`{"NextToken": "abc"}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestFileEventSource_LookupEvents(t *testing.T) {
+	dir := t.TempDir()
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte(`{"Records":[` + webIdentityRecord + `]}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "2026", "01"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2026", "01", "log.json.gz"), gz.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "export.jsonl"), []byte(assumedRoleRecord+"\n"), 0o644))
+
+	client := Client{logger: slog.Default()}.WithEventSource(NewFileEventSource(slog.Default(), dir))
+	filter := EventsFilter{StartTime: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	events, err := client.LookupEvents("default", "app", filter)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	sessions := events.Sessions()
+	require.Len(t, sessions, 1)
+
+	events, err = client.LookupSessionEvents(sessions[0], filter)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "GetObject", events[0].EventName)
+
+	// time window and event filters are applied
+	events, err = client.LookupSessionEvents(sessions[0], EventsFilter{StartTime: filter.StartTime, EndTime: filter.StartTime.Add(10 * time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = client.LookupSessionEvents(sessions[0], EventsFilter{StartTime: filter.StartTime, EventNames: []string{"PutObject"}})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
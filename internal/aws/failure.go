@@ -0,0 +1,144 @@
+package aws
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type FailureCause string
+
+const (
+	FailureCauseStalePod                 FailureCause = "stale pod"
+	FailureCauseRoleMissing              FailureCause = "role missing"
+	FailureCauseTrustMismatch            FailureCause = "trust policy mismatch"
+	FailureCauseInvalidIdentityToken     FailureCause = "invalid identity token"
+	FailureCauseExpiredToken             FailureCause = "expired token"
+	FailureCauseClockSkew                FailureCause = "clock skew"
+	FailureCauseRegionalEndpointDisabled FailureCause = "regional sts endpoint disabled"
+	FailureCauseUnknown                  FailureCause = "unknown"
+)
+
+var failureFixes = map[FailureCause]string{
+	FailureCauseStalePod:                 "restart pods created before the role annotation change, see 'kubectl-iam4sa stale'",
+	FailureCauseRoleMissing:              "create the role, or fix eks.amazonaws.com/role-arn annotation",
+	FailureCauseTrustMismatch:            "update role trust policy sub and aud conditions, see 'kubectl-iam4sa doctor'",
+	FailureCauseInvalidIdentityToken:     "verify IAM OIDC provider for the cluster issuer exists and has correct client ids, see 'kubectl-iam4sa cluster'",
+	FailureCauseExpiredToken:             "token is rotated by kubelet, verify that the application (AWS SDK) re-reads the token file",
+	FailureCauseClockSkew:                "synchronize node clock (e.g. chrony or Amazon Time Sync Service)",
+	FailureCauseRegionalEndpointDisabled: "activate STS in the region (IAM account settings), or set AWS_STS_REGIONAL_ENDPOINTS=legacy",
+	FailureCauseUnknown:                  "inspect the event in CloudTrail",
+}
+
+// Fix returns suggested fix for the failure cause
+func (f FailureCause) Fix() string {
+	return failureFixes[f]
+}
+
+// FailureState is current state of the service account and its role, used to classify AssumeRoleWithWebIdentity
+// failures. Role is nil if the role does not exist, RoleChecked is false if the role could not be fetched (e.g.
+// missing permissions or foreign account)
+type FailureState struct {
+	RoleArn     string // service account role annotation
+	RoleChecked bool
+	Role        *Role
+	Identity    WebIdentity // expected web identity of the service account
+}
+
+// Failure is classified failed event, Detail explains the cause
+type Failure struct {
+	Event  Event
+	Cause  FailureCause
+	Detail string
+}
+
+// ClassifyFailure maps failed AssumeRoleWithWebIdentity event to its cause, using the error code and message, request
+// parameters, user identity and the current service account and role state
+func ClassifyFailure(event Event, state FailureState) Failure {
+	failure := Failure{Event: event, Cause: FailureCauseUnknown, Detail: event.ErrorMessage}
+	message := strings.ToLower(event.ErrorMessage)
+
+	switch {
+	case strings.Contains(event.ErrorCode, "RegionDisabled") || strings.Contains(message, "not activated in this region"):
+		failure.Cause = FailureCauseRegionalEndpointDisabled
+		failure.Detail = fmt.Sprintf("STS is not activated in %s region", event.Region)
+	case strings.Contains(message, "used before issued") || strings.Contains(message, "issued in the future") || strings.Contains(message, "clock skew"):
+		failure.Cause = FailureCauseClockSkew
+	case strings.Contains(event.ErrorCode, "ExpiredToken") || strings.Contains(message, "token expired"):
+		failure.Cause = FailureCauseExpiredToken
+	case strings.Contains(event.ErrorCode, "InvalidIdentityToken"):
+		failure.Cause = FailureCauseInvalidIdentityToken
+	case strings.Contains(event.ErrorCode, "AccessDenied"):
+		failure.Cause, failure.Detail = classifyAccessDenied(event, state)
+	}
+	return failure
+}
+
+// classifyAccessDenied returns cause of AccessDenied error (STS returns "Not authorized to perform
+// sts:AssumeRoleWithWebIdentity" or "An unknown error occurred" for all of them)
+func classifyAccessDenied(event Event, state FailureState) (FailureCause, string) {
+	requestRoleArn := event.RequestParameters.RoleArn
+	if state.RoleArn != "" && requestRoleArn != "" && !strings.EqualFold(requestRoleArn, state.RoleArn) {
+		return FailureCauseStalePod, fmt.Sprintf("requested role %s differs from annotation %s", requestRoleArn, state.RoleArn)
+	}
+	if state.RoleChecked && state.Role == nil {
+		return FailureCauseRoleMissing, fmt.Sprintf("role %s does not exist", cmp.Or(requestRoleArn, state.RoleArn))
+	}
+	if state.Role == nil {
+		return FailureCauseUnknown, event.ErrorMessage
+	}
+
+	identity := state.Identity
+	if event.UserIdentity.UserName != "" {
+		identity.Subject = event.UserIdentity.UserName
+	}
+	verdict := EvaluateTrustPolicy(state.Role.AssumeRolePolicyDocument, identity)
+	if verdict.Allowed {
+		return FailureCauseUnknown, fmt.Sprintf("%s, trust policy allows the identity now", event.ErrorMessage)
+	}
+	var failures []string
+	for _, failure := range verdict.Failures {
+		failures = append(failures, failure.String())
+	}
+	return FailureCauseTrustMismatch, strings.Join(failures, "; ")
+}
+
+// FailureGroup is group of failures with the same cause, Latest is the time of the latest failure and Detail is the
+// detail of the latest failure that has one
+type FailureGroup struct {
+	Cause  FailureCause
+	Count  int
+	Latest time.Time
+	Detail string
+}
+
+// GroupFailures classifies failed events and groups them by cause, groups are sorted by count (highest first)
+func GroupFailures(events Events, state FailureState) []FailureGroup {
+	groups := make(map[FailureCause]*FailureGroup)
+	for _, event := range events.FailedEvents() {
+		failure := ClassifyFailure(event, state)
+		group, ok := groups[failure.Cause]
+		if !ok {
+			group = &FailureGroup{Cause: failure.Cause}
+			groups[failure.Cause] = group
+		}
+		group.Count++
+		if event.EventTime.After(group.Latest) {
+			group.Latest = event.EventTime
+			group.Detail = cmp.Or(failure.Detail, group.Detail)
+		} else if group.Detail == "" {
+			group.Detail = failure.Detail
+		}
+	}
+
+	var out []FailureGroup
+	for _, group := range groups {
+		out = append(out, *group)
+	}
+	slices.SortFunc(out, func(a, b FailureGroup) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(string(a.Cause), string(b.Cause)))
+	})
+	return out
+}
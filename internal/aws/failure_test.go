@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	role := Role{ARN: "arn:aws:iam::123456789123:role/ingest", AssumeRolePolicyDocument: testTrustPolicy}
+	state := FailureState{
+		RoleArn:     role.ARN,
+		RoleChecked: true,
+		Role:        &role,
+		Identity:    NewWebIdentity(testCluster, "prometheus", "ingest", ""),
+	}
+	accessDenied := func(roleArn, username string) Event {
+		return Event{
+			ErrorCode:         "AccessDenied",
+			ErrorMessage:      "An unknown error occurred",
+			UserIdentity:      UserIdentity{UserName: username},
+			RequestParameters: RequestParameters{RoleArn: roleArn},
+		}
+	}
+
+	tcs := []struct {
+		name     string
+		event    Event
+		state    FailureState
+		expected FailureCause
+	}{
+		{"stale pod", accessDenied("arn:aws:iam::123456789123:role/old", "system:serviceaccount:prometheus:ingest"), state, FailureCauseStalePod},
+		{"role missing", accessDenied(role.ARN, ""), FailureState{RoleArn: role.ARN, RoleChecked: true}, FailureCauseRoleMissing},
+		{"role not checked", accessDenied(role.ARN, ""), FailureState{RoleArn: role.ARN}, FailureCauseUnknown},
+		{"trust mismatch", accessDenied(role.ARN, "system:serviceaccount:prometheus:other"), state, FailureCauseTrustMismatch},
+		{"trust allows now", accessDenied(role.ARN, "system:serviceaccount:prometheus:ingest"), state, FailureCauseUnknown},
+		{"invalid token", Event{ErrorCode: "InvalidIdentityTokenException", ErrorMessage: "No OpenIDConnect provider found in your account"}, state, FailureCauseInvalidIdentityToken},
+		{"expired token", Event{ErrorCode: "ExpiredTokenException", ErrorMessage: "Token expired: current date/time 1700000000 must be before the expiration date/time 1699990000"}, state, FailureCauseExpiredToken},
+		{"clock skew", Event{ErrorCode: "InvalidIdentityTokenException", ErrorMessage: "Token used before issued"}, state, FailureCauseClockSkew},
+		{"region disabled", Event{ErrorCode: "RegionDisabledException", Region: "ap-east-1"}, state, FailureCauseRegionalEndpointDisabled},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			failure := ClassifyFailure(tc.event, tc.state)
+			assert.Equal(t, tc.expected, failure.Cause, failure.Detail)
+			assert.NotEmpty(t, failure.Cause.Fix())
+		})
+	}
+}
+
+func TestGroupFailures(t *testing.T) {
+	now := time.Now()
+	events := Events{
+		{EventTime: now, ErrorCode: "ExpiredTokenException", ErrorMessage: "Token expired"},
+		{EventTime: now.Add(-time.Minute), ErrorCode: "AccessDenied", RequestParameters: RequestParameters{RoleArn: "arn:aws:iam::123456789123:role/old"}},
+		{EventTime: now.Add(-2 * time.Minute), ErrorCode: "AccessDenied", RequestParameters: RequestParameters{RoleArn: "arn:aws:iam::123456789123:role/old"}},
+		{EventTime: now.Add(-3 * time.Minute)},
+	}
+
+	groups := GroupFailures(events, FailureState{RoleArn: "arn:aws:iam::123456789123:role/new"})
+	require.Len(t, groups, 2)
+	assert.Equal(t, FailureCauseStalePod, groups[0].Cause)
+	assert.Equal(t, 2, groups[0].Count)
+	assert.Equal(t, now.Add(-time.Minute), groups[0].Latest)
+	assert.Equal(t, FailureCauseExpiredToken, groups[1].Cause)
+
+	t.Run("latest without detail", func(t *testing.T) {
+		events := Events{
+			{EventTime: now, ErrorCode: "AccessDenied"},
+			{EventTime: now.Add(-time.Minute), ErrorCode: "AccessDenied", ErrorMessage: "Not authorized"},
+		}
+		groups := GroupFailures(events, FailureState{})
+		require.Len(t, groups, 1)
+		assert.Equal(t, now, groups[0].Latest)
+		assert.Equal(t, "Not authorized", groups[0].Detail)
+	})
+}
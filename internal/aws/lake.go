@@ -0,0 +1,224 @@
+package aws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	lakeTimeLayout       = "2006-01-02 15:04:05"
+	lakePollInterval     = time.Second
+	lakeMaxQueryResults  = 1000
+	eventDataStorePrefix = "eventdatastore/"
+)
+
+// lakeEventSelect are CloudTrail Lake event columns mapped to Event, requestParameters and responseElements are maps
+// with nested objects as json strings
+const lakeEventSelect = `SELECT eventID, eventTime, eventSource, eventName, awsRegion, sourceIPAddress, userAgent,
+ errorCode, errorMessage, requestID, eventType, userIdentity.type AS identityType,
+ userIdentity.principalId AS principalId, userIdentity.arn AS identityArn, userIdentity.userName AS userName,
+ userIdentity.accessKeyId AS accessKeyId, userIdentity.identityProvider AS identityProvider, element_at(requestParameters, 'roleArn') AS roleArn,
+ element_at(requestParameters, 'roleSessionName') AS roleSessionName,
+ element_at(responseElements, 'assumedRoleUser') AS assumedRoleUser`
+
+// lakeClient is CloudTrail Lake query API
+type lakeClient interface {
+	StartQuery(ctx context.Context, in *cloudtrail.StartQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error)
+	GetQueryResults(ctx context.Context, in *cloudtrail.GetQueryResultsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetQueryResultsOutput, error)
+}
+
+// lakeEventSource runs SQL queries against CloudTrail Lake event data store. Event data store of organization trail
+// has events from all accounts and regions, so one query returns events that LookupEvents (single account and region)
+// misses. Event resources are not mapped.
+type lakeEventSource struct {
+	logger         *slog.Logger
+	client         lakeClient
+	eventDataStore string // event data store id
+	issuerHost     string // cluster oidc issuer host, web identity events of other clusters are excluded
+	pollInterval   time.Duration
+}
+
+// WithEventStore returns copy of the client that looks up CloudTrail events in the CloudTrail Lake event data store,
+// queries run in the event data store region. AssumeRoleWithWebIdentity events are scoped to the cluster oidc issuer
+// host, because event data store of organization trail has events of service accounts in all clusters.
+func (c Client) WithEventStore(eventDataStoreArn, issuerHost string) (Client, error) {
+	a, err := arn.Parse(eventDataStoreArn)
+	if err != nil {
+		return Client{}, fmt.Errorf("invalid event data store arn %s: %w", eventDataStoreArn, err)
+	}
+	id, ok := strings.CutPrefix(a.Resource, eventDataStorePrefix)
+	if a.Service != "cloudtrail" || !ok || id == "" {
+		return Client{}, fmt.Errorf("invalid event data store arn %s: expected arn:<partition>:cloudtrail:<region>:<account>:eventdatastore/<id>", eventDataStoreArn)
+	}
+
+	client := cloudtrail.NewFromConfig(c.cfg, func(o *cloudtrail.Options) { o.Region = a.Region })
+	c.eventSource = lakeEventSource{logger: c.logger, client: client, eventDataStore: id, issuerHost: issuerHost, pollInterval: lakePollInterval}
+	return c, nil
+}
+
+func (s lakeEventSource) LookupEvents(ctx context.Context, attribute cloudtrailtypes.LookupAttribute, filter EventsFilter) (Events, error) {
+	condition, err := lakeAttributeCondition(attribute)
+	if err != nil {
+		return nil, err
+	}
+	query := lakeQuery(s.eventDataStore, condition, s.issuerHost, filter)
+	s.logger.Debug(fmt.Sprintf("cloudtrail lake query: %s", query))
+
+	out, err := s.client.StartQuery(ctx, &cloudtrail.StartQueryInput{QueryStatement: aws.String(query)})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.queryResults(ctx, aws.ToString(out.QueryId))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(Events, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, toLakeEvent(row))
+	}
+	return events, nil
+}
+
+// queryResults waits for the query to finish and returns all result rows
+func (s lakeEventSource) queryResults(ctx context.Context, queryId string) ([][]map[string]string, error) {
+	in := &cloudtrail.GetQueryResultsInput{QueryId: aws.String(queryId), MaxQueryResults: aws.Int32(lakeMaxQueryResults)}
+	var rows [][]map[string]string
+	for {
+		out, err := s.client.GetQueryResults(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+
+		switch out.QueryStatus {
+		case cloudtrailtypes.QueryStatusQueued, cloudtrailtypes.QueryStatusRunning:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(s.pollInterval):
+			}
+			continue
+		case cloudtrailtypes.QueryStatusFinished:
+		default:
+			return nil, fmt.Errorf("query %s %s: %s", queryId, out.QueryStatus, cmp.Or(aws.ToString(out.ErrorMessage), "no error message"))
+		}
+
+		rows = append(rows, out.QueryResultRows...)
+		if aws.ToString(out.NextToken) == "" {
+			return rows, nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// lakeAttributeCondition returns SQL condition for the lookup attribute, username matches user name of the identity, or
+// session name of the assumed role (the same as LookupEvents)
+func lakeAttributeCondition(attribute cloudtrailtypes.LookupAttribute) (string, error) {
+	value := sqlString(aws.ToString(attribute.AttributeValue))
+	switch attribute.AttributeKey {
+	case cloudtrailtypes.LookupAttributeKeyUsername:
+		session := sqlString("%/" + aws.ToString(attribute.AttributeValue))
+		return fmt.Sprintf("(userIdentity.userName = %s OR (userIdentity.type = 'AssumedRole' AND userIdentity.arn LIKE %s))", value, session), nil
+	case cloudtrailtypes.LookupAttributeKeyEventName:
+		return fmt.Sprintf("eventName = %s", value), nil
+	case cloudtrailtypes.LookupAttributeKeyEventSource:
+		return fmt.Sprintf("eventSource = %s", value), nil
+	case cloudtrailtypes.LookupAttributeKeyEventId:
+		return fmt.Sprintf("eventID = %s", value), nil
+	case cloudtrailtypes.LookupAttributeKeyAccessKeyId:
+		return fmt.Sprintf("userIdentity.accessKeyId = %s", value), nil
+	}
+	return "", fmt.Errorf("unsupported lookup attribute %s", attribute.AttributeKey)
+}
+
+// lakeQuery returns query for events that match the condition in the filter time window (latest first), event name
+// and source filters are applied as well, to reduce scanned data. AssumeRoleWithWebIdentity events are limited to the
+// issuer host oidc providers (in any account), if the issuer host is set.
+func lakeQuery(eventDataStore, condition, issuerHost string, filter EventsFilter) string {
+	conditions := []string{condition, fmt.Sprintf("eventTime >= %s", sqlString(filter.StartTime.UTC().Format(lakeTimeLayout)))}
+	if issuerHost != "" {
+		provider := sqlString("%:oidc-provider/" + issuerHost)
+		conditions = append(conditions, fmt.Sprintf("(eventName <> '%s' OR userIdentity.identityProvider LIKE %s)", eventNameAssumeRoleWithWebIdentity, provider))
+	}
+	if !filter.EndTime.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("eventTime <= %s", sqlString(filter.EndTime.UTC().Format(lakeTimeLayout))))
+	}
+	if len(filter.EventNames) != 0 {
+		conditions = append(conditions, fmt.Sprintf("eventName IN (%s)", sqlStrings(filter.EventNames)))
+	}
+	if len(filter.EventSources) != 0 {
+		conditions = append(conditions, fmt.Sprintf("eventSource IN (%s)", sqlStrings(filter.EventSources)))
+	}
+	return fmt.Sprintf("%s FROM %s WHERE %s ORDER BY eventTime DESC", lakeEventSelect, eventDataStore, strings.Join(conditions, " AND "))
+}
+
+// sqlString returns quoted SQL string literal
+func sqlString(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+func sqlStrings(values []string) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, sqlString(v))
+	}
+	return strings.Join(out, ", ")
+}
+
+// toLakeEvent returns event from query result row, row is list of column to value maps
+func toLakeEvent(row []map[string]string) Event {
+	columns := make(map[string]string)
+	for _, column := range row {
+		for k, v := range column {
+			columns[k] = v
+		}
+	}
+
+	event := Event{
+		EventTime:    parseLakeTime(columns["eventTime"]),
+		EventId:      columns["eventID"],
+		EventSource:  columns["eventSource"],
+		EventName:    columns["eventName"],
+		ErrorCode:    columns["errorCode"],
+		ErrorMessage: columns["errorMessage"],
+		UserIdentity: UserIdentity{
+			Type:             columns["identityType"],
+			PrincipalId:      columns["principalId"],
+			Arn:              columns["identityArn"],
+			AccessKeyId:      columns["accessKeyId"],
+			UserName:         columns["userName"],
+			IdentityProvider: columns["identityProvider"],
+		},
+		Region:            columns["awsRegion"],
+		SourceIP:          columns["sourceIPAddress"],
+		UserAgent:         columns["userAgent"],
+		RequestParameters: RequestParameters{RoleArn: columns["roleArn"], RoleSessionName: columns["roleSessionName"]},
+		RequestId:         columns["requestID"],
+		EventType:         columns["eventType"],
+	}
+	if v := columns["assumedRoleUser"]; v != "" {
+		// not set, if the value is not json, sessions fall back to assumed role arn derived from the role arn
+		_ = json.Unmarshal([]byte(v), &event.ResponseElements.AssumedRoleUser)
+	}
+	event.UserName = eventUsername(event.UserIdentity)
+	return event
+}
+
+// parseLakeTime parses CloudTrail Lake timestamp (e.g. 2023-11-23 15:35:48.000), zero time if the value is invalid
+func parseLakeTime(v string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.000", lakeTimeLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,119 @@
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// lakeStub returns queued status first, and then results in pages
+type lakeStub struct {
+	query  string
+	pages  []*cloudtrail.GetQueryResultsOutput
+	queued bool
+	calls  int
+}
+
+func (s *lakeStub) StartQuery(_ context.Context, in *cloudtrail.StartQueryInput, _ ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error) {
+	s.query = aws.ToString(in.QueryStatement)
+	return &cloudtrail.StartQueryOutput{QueryId: aws.String("query-1")}, nil
+}
+
+func (s *lakeStub) GetQueryResults(_ context.Context, in *cloudtrail.GetQueryResultsInput, _ ...func(*cloudtrail.Options)) (*cloudtrail.GetQueryResultsOutput, error) {
+	s.calls++
+	if !s.queued {
+		s.queued = true
+		return &cloudtrail.GetQueryResultsOutput{QueryStatus: cloudtrailtypes.QueryStatusQueued}, nil
+	}
+	page := 0
+	if in.NextToken != nil {
+		page = 1
+	}
+	return s.pages[page], nil
+}
+
+func TestLakeEventSource_LookupEvents(t *testing.T) {
+	webIdentityRow := []map[string]string{
+		{"eventID": "event-1"},
+		{"eventTime": "2026-01-01 10:00:00.000"},
+		{"eventSource": "sts.amazonaws.com"},
+		{"eventName": "AssumeRoleWithWebIdentity"},
+		{"awsRegion": "us-east-1"},
+		{"errorCode": ""},
+		{"identityType": "WebIdentityUser"},
+		{"userName": "system:serviceaccount:default:app"},
+		{"identityProvider": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC"},
+		{"roleArn": "arn:aws:iam::123456789123:role/app"},
+		{"roleSessionName": "session-1"},
+		{"assumedRoleUser": `{"assumedRoleId":"AROA:session-1","arn":"arn:aws:sts::123456789123:assumed-role/app/session-1"}`},
+	}
+	failedRow := []map[string]string{
+		{"eventID": "event-2"},
+		{"eventTime": "2026-01-01 09:00:00.000"},
+		{"eventName": "AssumeRoleWithWebIdentity"},
+		{"errorCode": "AccessDenied"},
+		{"userName": "system:serviceaccount:default:app"},
+	}
+	stub := &lakeStub{pages: []*cloudtrail.GetQueryResultsOutput{
+		{QueryStatus: cloudtrailtypes.QueryStatusFinished, QueryResultRows: [][]map[string]string{webIdentityRow}, NextToken: aws.String("next")},
+		{QueryStatus: cloudtrailtypes.QueryStatusFinished, QueryResultRows: [][]map[string]string{failedRow}},
+	}}
+	source := lakeEventSource{logger: slog.Default(), client: stub, eventDataStore: "eds-1", issuerHost: "oidc.eks.us-east-1.amazonaws.com/id/ABC"}
+	client := Client{logger: slog.Default()}.WithEventSource(source)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events, err := client.LookupEvents("default", "app", EventsFilter{StartTime: start, EventNames: []string{"AssumeRoleWithWebIdentity"}})
+	require.NoError(t, err)
+	assert.Contains(t, stub.query, "FROM eds-1 WHERE (userIdentity.userName = 'system:serviceaccount:default:app' OR")
+	assert.Contains(t, stub.query, "eventTime >= '2026-01-01 00:00:00' AND "+
+		"(eventName <> 'AssumeRoleWithWebIdentity' OR userIdentity.identityProvider LIKE '%:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC') AND "+
+		"eventName IN ('AssumeRoleWithWebIdentity') ORDER BY eventTime DESC")
+	assert.Equal(t, 3, stub.calls)
+
+	require.Len(t, events, 2)
+	assert.Equal(t, time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), events[0].EventTime)
+	assert.Equal(t, "us-east-1", events[0].Region)
+	assert.Equal(t, "system:serviceaccount:default:app", events[0].UserName)
+	assert.Equal(t, "arn:aws:iam::123456789123:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC", events[0].UserIdentity.IdentityProvider)
+	assert.Equal(t, []Session{{RoleSessionName: "session-1", AssumedRoleArn: "arn:aws:sts::123456789123:assumed-role/app/session-1",
+		FirstSeen: events[0].EventTime, LastSeen: events[0].EventTime, Count: 1}}, events.Sessions())
+	assert.Len(t, events.FailedEvents(), 1)
+}
+
+func TestLakeEventSource_LookupEventsFailed(t *testing.T) {
+	stub := &lakeStub{queued: true, pages: []*cloudtrail.GetQueryResultsOutput{
+		{QueryStatus: cloudtrailtypes.QueryStatusFailed, ErrorMessage: aws.String("invalid column")},
+	}}
+	source := lakeEventSource{logger: slog.Default(), client: stub, eventDataStore: "eds-1"}
+	attribute := cloudtrailtypes.LookupAttribute{AttributeKey: cloudtrailtypes.LookupAttributeKeyEventName, AttributeValue: aws.String("x")}
+	_, err := source.LookupEvents(t.Context(), attribute, EventsFilter{})
+	require.EqualError(t, err, "query query-1 FAILED: invalid column")
+}
+
+func Test_lakeAttributeCondition(t *testing.T) {
+	condition, err := lakeAttributeCondition(cloudtrailtypes.LookupAttribute{
+		AttributeKey:   cloudtrailtypes.LookupAttributeKeyUsername,
+		AttributeValue: aws.String("o'brien"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(userIdentity.userName = 'o''brien' OR (userIdentity.type = 'AssumedRole' AND userIdentity.arn LIKE '%/o''brien'))", condition)
+
+	_, err = lakeAttributeCondition(cloudtrailtypes.LookupAttribute{AttributeKey: cloudtrailtypes.LookupAttributeKeyResourceName})
+	assert.Error(t, err)
+}
+
+func TestClient_WithEventStore(t *testing.T) {
+	client, err := Client{logger: slog.Default()}.WithEventStore("arn:aws:cloudtrail:us-east-1:123456789123:eventdatastore/eds-1", "oidc.eks.us-east-1.amazonaws.com/id/ABC")
+	require.NoError(t, err)
+	assert.Equal(t, "eds-1", client.eventSource.(lakeEventSource).eventDataStore)
+	assert.Equal(t, "oidc.eks.us-east-1.amazonaws.com/id/ABC", client.eventSource.(lakeEventSource).issuerHost)
+
+	_, err = Client{}.WithEventStore("arn:aws:cloudtrail:us-east-1:123456789123:trail/main", "")
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package aws
 import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"strings"
 	"time"
 )
 
@@ -23,3 +24,77 @@ func toOidcProvider(oidc *iam.GetOpenIDConnectProviderOutput, arn string) OidcPr
 		Url:         aws.ToString(oidc.Url),
 	}
 }
+
+// OidcProviderMatches are IAM oidc providers that match cluster oidc issuer. Exact providers have the same url
+// (ignoring case, scheme and trailing slash), more than one exact provider means duplicates. Near providers have
+// the same issuer id in different region, or similar issuer id (e.g. typo or provider of recreated cluster)
+type OidcProviderMatches struct {
+	Exact []string
+	Near  []string
+}
+
+// Duplicates returns exact matching providers other than the provider arn
+func (m OidcProviderMatches) Duplicates(providerArn string) []string {
+	var out []string
+	for _, v := range m.Exact {
+		if v != providerArn {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// maxIssuerIdDistance is max edit distance between issuer ids to report the provider as near match
+const maxIssuerIdDistance = 3
+
+// MatchOidcProviders matches IAM oidc provider arns against cluster oidc issuer host (issuer without scheme)
+func MatchOidcProviders(issuerHost string, providerArns []string) OidcProviderMatches {
+	issuerHost = normalizeOidcUrl(issuerHost)
+	issuerPrefix, issuerId, _ := strings.Cut(issuerHost, "/id/")
+
+	var out OidcProviderMatches
+	for _, providerArn := range providerArns {
+		_, providerUrl, ok := strings.Cut(providerArn, ":oidc-provider/")
+		if !ok {
+			continue
+		}
+		providerUrl = normalizeOidcUrl(providerUrl)
+		if providerUrl == issuerHost {
+			out.Exact = append(out.Exact, providerArn)
+			continue
+		}
+		prefix, id, ok := strings.Cut(providerUrl, "/id/")
+		if !ok || issuerId == "" {
+			continue
+		}
+		if id == issuerId || (prefix == issuerPrefix && editDistance(id, issuerId) <= maxIssuerIdDistance) {
+			out.Near = append(out.Near, providerArn)
+		}
+	}
+	return out
+}
+
+func normalizeOidcUrl(v string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(v), "https://"), "/")
+}
+
+// editDistance returns levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatchOidcProviders(t *testing.T) {
+	providerArns := []string{
+		"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABCDEF0123456789",
+		"arn:aws:iam::987654321987:oidc-provider/OIDC.eks.eu-west-2.amazonaws.com/id/abcdef0123456789/",
+		"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABCDEF0123456780",
+		"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-1.amazonaws.com/id/ABCDEF0123456789",
+		"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/0000000000000000",
+		"arn:aws:iam::123456789123:oidc-provider/token.actions.githubusercontent.com",
+	}
+
+	matches := MatchOidcProviders("oidc.eks.eu-west-2.amazonaws.com/id/ABCDEF0123456789", providerArns)
+	assert.Equal(t, providerArns[:2], matches.Exact)
+	assert.Equal(t, providerArns[2:4], matches.Near)
+	assert.Equal(t, providerArns[1:2], matches.Duplicates(providerArns[0]))
+}
+
+func TestCluster_OidcProviderArn(t *testing.T) {
+	cluster := Cluster{
+		Arn:        "arn:aws-cn:eks:cn-north-1:123456789123:cluster/main",
+		OidcIssuer: "https://oidc.eks.cn-north-1.amazonaws.com.cn/id/ABCDEF0123456789",
+	}
+	assert.Equal(t, "arn:aws-cn:iam::123456789123:oidc-provider/oidc.eks.cn-north-1.amazonaws.com.cn/id/ABCDEF0123456789", cluster.OidcProviderArn())
+	assert.Equal(t, "", Cluster{OidcIssuer: cluster.OidcIssuer}.OidcProviderArn())
+}
+
+func Test_partitionForRegion(t *testing.T) {
+	assert.Equal(t, "aws", partitionForRegion("eu-west-2"))
+	assert.Equal(t, "aws-cn", partitionForRegion("cn-northwest-1"))
+	assert.Equal(t, "aws-us-gov", partitionForRegion("us-gov-west-1"))
+}
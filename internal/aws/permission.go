@@ -0,0 +1,191 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"slices"
+	"strings"
+)
+
+type PermissionDecision string
+
+const (
+	DecisionAllowed      PermissionDecision = "allowed"
+	DecisionExplicitDeny PermissionDecision = "explicitDeny"
+	DecisionImplicitDeny PermissionDecision = "implicitDeny"
+)
+
+// PermissionRequest is action on resource made by the role, Context is condition key (e.g. aws:SourceIp) to request
+// values, condition keys are case-insensitive
+type PermissionRequest struct {
+	Action   string
+	Resource string
+	Context  map[string][]string
+}
+
+// contextValues returns request values for the condition key, empty if the key is not present
+func (r PermissionRequest) contextValues(key string) []string {
+	for k, v := range r.Context {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// PolicyStatement identifies statement in a policy, Policy is policy arn or inline policy name
+type PolicyStatement struct {
+	Policy    string
+	Statement string
+	Effect    string
+}
+
+func (p PolicyStatement) String() string {
+	return fmt.Sprintf("statement %s (%s) in policy %s", p.Statement, p.Effect, p.Policy)
+}
+
+// PermissionVerdict is the result of the identity policies evaluation. Statement is the deciding statement (nil for
+// implicit deny), Reason explains the decision and Notes contain parts of the policies that could not be evaluated
+// (e.g. unsupported condition operators, invalid documents).
+type PermissionVerdict struct {
+	Decision  PermissionDecision
+	Statement *PolicyStatement
+	Reason    string
+	Notes     []string
+}
+
+func (v PermissionVerdict) Allowed() bool {
+	return v.Decision == DecisionAllowed
+}
+
+// EvaluatePermission evaluates identity policies (attached and inline) and permissions boundary of the role, the same
+// way IAM does for same account requests: explicit deny in any policy wins, then the action has to be allowed by the
+// permissions boundary (if set) and by at least one identity policy. Resource based policies, session policies and
+// SCPs are not evaluated.
+func EvaluatePermission(policies RolePolicies, request PermissionRequest) PermissionVerdict {
+	var notes []string
+	identity := append(slices.Clone(policies.Attached), policies.Inline...)
+	all := identity
+	if policies.PermissionsBoundary != nil {
+		all = append(slices.Clone(identity), *policies.PermissionsBoundary)
+	}
+
+	for _, policy := range all {
+		if statement, ok := matchPolicy(policy, request, EffectDeny, &notes); ok {
+			return PermissionVerdict{
+				Decision:  DecisionExplicitDeny,
+				Statement: &statement,
+				Reason:    fmt.Sprintf("explicitly denied by %s", statement),
+				Notes:     notes,
+			}
+		}
+	}
+
+	if policies.PermissionsBoundary != nil {
+		if _, ok := matchPolicy(*policies.PermissionsBoundary, request, EffectAllow, &notes); !ok {
+			return PermissionVerdict{
+				Decision: DecisionImplicitDeny,
+				Reason:   fmt.Sprintf("not allowed by permissions boundary %s", policies.PermissionsBoundary),
+				Notes:    notes,
+			}
+		}
+	}
+
+	for _, policy := range identity {
+		if statement, ok := matchPolicy(policy, request, EffectAllow, &notes); ok {
+			return PermissionVerdict{
+				Decision:  DecisionAllowed,
+				Statement: &statement,
+				Reason:    fmt.Sprintf("allowed by %s", statement),
+				Notes:     notes,
+			}
+		}
+	}
+	return PermissionVerdict{
+		Decision: DecisionImplicitDeny,
+		Reason:   "no identity policy statement allows the action on the resource",
+		Notes:    notes,
+	}
+}
+
+// matchPolicy returns the first statement with the effect that applies to the request, problems are appended to notes.
+// Conditions with unsupported operators are assumed to match Deny and not to match Allow statements, so the request is
+// never allowed if IAM may deny it.
+func matchPolicy(policy Policy, request PermissionRequest, effect string, notes *[]string) (PolicyStatement, bool) {
+	document, err := ParsePolicyDocument(policy.Document)
+	if err != nil {
+		note := fmt.Sprintf("policy %s: %v", policy, err)
+		if !slices.Contains(*notes, note) {
+			*notes = append(*notes, note)
+		}
+		return PolicyStatement{}, false
+	}
+
+	for i, statement := range document.Statement {
+		if !strings.EqualFold(statement.Effect, effect) {
+			continue
+		}
+		if !statement.MatchesAction(request.Action) || !statement.MatchesResource(request.Resource) {
+			continue
+		}
+		match, unsupported := statement.matchesConditions(request)
+		for _, operator := range unsupported {
+			note := fmt.Sprintf("policy %s statement %s: unsupported condition operator %s", policy, statement.Name(i), operator)
+			if !slices.Contains(*notes, note) {
+				*notes = append(*notes, note)
+			}
+		}
+		if match && (len(unsupported) == 0 || strings.EqualFold(effect, EffectDeny)) {
+			return PolicyStatement{Policy: policy.String(), Statement: statement.Name(i), Effect: statement.Effect}, true
+		}
+	}
+	return PolicyStatement{}, false
+}
+
+// MatchesResource returns true if the statement applies to supplied resource arn, taking into account Resource,
+// NotResource and wildcards. Resource arns are case-sensitive.
+func (s Statement) MatchesResource(resource string) bool {
+	if len(s.NotResource) != 0 {
+		return !matchAny(s.NotResource, resource, matchWildcard)
+	}
+	return matchAny(s.Resource, resource, matchWildcard)
+}
+
+// matchesConditions returns true if all supported statement conditions match the request context. Unsupported
+// operators are skipped and returned, so the caller decides how to treat them and can report them.
+func (s Statement) matchesConditions(request PermissionRequest) (bool, []string) {
+	var unsupported []string
+	match := true
+	for operator, keys := range s.Condition {
+		for key, values := range keys {
+			ok, supported := conditionMatches(operator, values, request.contextValues(key))
+			if !supported {
+				unsupported = append(unsupported, operator)
+				break
+			}
+			if !ok {
+				match = false
+			}
+		}
+	}
+	slices.Sort(unsupported)
+	return match, unsupported
+}
+
+// Simulation is IAM policy simulator result, Decision is one of the PermissionDecision values
+type Simulation struct {
+	Decision          PermissionDecision
+	MatchedStatements []string
+}
+
+func toSimulation(result iamtypes.EvaluationResult) Simulation {
+	var matched []string
+	for _, statement := range result.MatchedStatements {
+		matched = append(matched, aws.ToString(statement.SourcePolicyId))
+	}
+	return Simulation{
+		Decision:          PermissionDecision(result.EvalDecision),
+		MatchedStatements: matched,
+	}
+}
@@ -0,0 +1,150 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testRolePolicies = RolePolicies{
+	Attached: []Policy{{
+		Name: "s3-read",
+		Arn:  "arn:aws:iam::123456789123:policy/s3-read",
+		Document: `{"Version": "2012-10-17", "Statement": [
+			{"Sid": "Read", "Effect": "Allow", "Action": ["s3:Get*", "s3:List*"], "Resource": "arn:aws:s3:::data/*"},
+			{"Sid": "DenySecret", "Effect": "Deny", "Action": "s3:*", "Resource": "arn:aws:s3:::data/secret/*"}]}`,
+	}},
+	Inline: []Policy{{
+		Name: "write",
+		Document: `{"Statement": {"Effect": "Allow", "Action": "s3:PutObject", "Resource": "arn:aws:s3:::data/*",
+			"Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}, "Bool": {"aws:SecureTransport": "true"}}}}`,
+	}},
+}
+
+func TestEvaluatePermission(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		verdict := EvaluatePermission(testRolePolicies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/file"})
+		assert.Equal(t, DecisionAllowed, verdict.Decision)
+		require.NotNil(t, verdict.Statement)
+		assert.Equal(t, "Read", verdict.Statement.Statement)
+		assert.Equal(t, "arn:aws:iam::123456789123:policy/s3-read", verdict.Statement.Policy)
+	})
+
+	t.Run("action is case insensitive", func(t *testing.T) {
+		verdict := EvaluatePermission(testRolePolicies, PermissionRequest{Action: "S3:getobject", Resource: "arn:aws:s3:::data/file"})
+		assert.True(t, verdict.Allowed())
+	})
+
+	t.Run("explicit deny", func(t *testing.T) {
+		verdict := EvaluatePermission(testRolePolicies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/secret/key"})
+		assert.Equal(t, DecisionExplicitDeny, verdict.Decision)
+		require.NotNil(t, verdict.Statement)
+		assert.Equal(t, "DenySecret", verdict.Statement.Statement)
+	})
+
+	t.Run("implicit deny", func(t *testing.T) {
+		verdict := EvaluatePermission(testRolePolicies, PermissionRequest{Action: "s3:DeleteObject", Resource: "arn:aws:s3:::data/file"})
+		assert.Equal(t, DecisionImplicitDeny, verdict.Decision)
+		assert.Nil(t, verdict.Statement)
+	})
+
+	t.Run("conditions", func(t *testing.T) {
+		request := PermissionRequest{
+			Action:   "s3:PutObject",
+			Resource: "arn:aws:s3:::data/file",
+			Context:  map[string][]string{"aws:sourceip": {"10.1.2.3"}, "aws:SecureTransport": {"true"}},
+		}
+		verdict := EvaluatePermission(testRolePolicies, request)
+		assert.True(t, verdict.Allowed())
+		assert.Equal(t, "write (inline)", verdict.Statement.Policy)
+
+		request.Context["aws:sourceip"] = []string{"192.168.1.1"}
+		verdict = EvaluatePermission(testRolePolicies, request)
+		assert.Equal(t, DecisionImplicitDeny, verdict.Decision)
+	})
+
+	t.Run("permissions boundary", func(t *testing.T) {
+		policies := testRolePolicies
+		policies.PermissionsBoundary = &Policy{
+			Name:     "boundary",
+			Arn:      "arn:aws:iam::123456789123:policy/boundary",
+			Document: `{"Statement": {"Effect": "Allow", "NotAction": "s3:Get*", "Resource": "*"}}`,
+		}
+		verdict := EvaluatePermission(policies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/file"})
+		assert.Equal(t, DecisionImplicitDeny, verdict.Decision)
+		assert.Contains(t, verdict.Reason, "permissions boundary")
+
+		verdict = EvaluatePermission(policies, PermissionRequest{Action: "s3:ListBucket", Resource: "arn:aws:s3:::data/file"})
+		assert.True(t, verdict.Allowed())
+	})
+
+	t.Run("not resource", func(t *testing.T) {
+		policies := RolePolicies{Inline: []Policy{{
+			Name:     "all-but-data",
+			Document: `{"Statement": {"Effect": "Allow", "Action": "s3:*", "NotResource": "arn:aws:s3:::data/*"}}`,
+		}}}
+		assert.True(t, EvaluatePermission(policies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::logs/file"}).Allowed())
+		assert.False(t, EvaluatePermission(policies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/file"}).Allowed())
+	})
+
+	t.Run("unsupported operator", func(t *testing.T) {
+		policies := RolePolicies{Inline: []Policy{{
+			Name:     "binary",
+			Document: `{"Statement": {"Effect": "Allow", "Action": "s3:*", "Resource": "*", "Condition": {"BinaryEquals": {"key": "QmluYXJ5"}}}}`,
+		}}}
+		verdict := EvaluatePermission(policies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/file"})
+		assert.False(t, verdict.Allowed())
+		require.Len(t, verdict.Notes, 1)
+		assert.Contains(t, verdict.Notes[0], "BinaryEquals")
+	})
+
+	t.Run("unsupported operator in deny", func(t *testing.T) {
+		policies := RolePolicies{Inline: []Policy{{
+			Name: "binary",
+			Document: `{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"},
+				{"Sid": "DenyBinary", "Effect": "Deny", "Action": "s3:*", "Resource": "*", "Condition": {"BinaryEquals": {"key": "QmluYXJ5"}}},
+				{"Sid": "DenyIp", "Effect": "Deny", "Action": "s3:*", "Resource": "*",
+				 "Condition": {"BinaryEquals": {"key": "QmluYXJ5"}, "IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}]}`,
+		}}}
+		verdict := EvaluatePermission(policies, PermissionRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::data/file"})
+		assert.Equal(t, DecisionExplicitDeny, verdict.Decision)
+		require.NotNil(t, verdict.Statement)
+		assert.Equal(t, "DenyBinary", verdict.Statement.Statement)
+		assert.NotEmpty(t, verdict.Notes)
+	})
+}
+
+func Test_conditionMatches(t *testing.T) {
+	tcs := []struct {
+		operator      string
+		policyValues  []string
+		requestValues []string
+		expected      bool
+	}{
+		{"NumericLessThan", []string{"10"}, []string{"5"}, true},
+		{"NumericLessThan", []string{"10"}, []string{"10"}, false},
+		{"NumericGreaterThanEquals", []string{"10"}, []string{"10"}, true},
+		{"NumericNotEquals", []string{"10"}, []string{"11"}, true},
+		{"DateLessThan", []string{"2026-01-01T00:00:00Z"}, []string{"2025-12-31T23:59:59Z"}, true},
+		{"DateGreaterThan", []string{"2026-01-01T00:00:00Z"}, []string{"1767225600"}, false},
+		{"Bool", []string{"true"}, []string{"TRUE"}, true},
+		{"IpAddress", []string{"10.0.0.0/8"}, []string{"10.1.1.1"}, true},
+		{"NotIpAddress", []string{"10.0.0.0/8"}, []string{"10.1.1.1"}, false},
+		{"ArnLike", []string{"arn:aws:iam::*:role/app-*"}, []string{"arn:aws:iam::123456789123:role/app-x"}, true},
+		{"ArnNotEquals", []string{"arn:aws:iam::123456789123:role/app"}, []string{"arn:aws:iam::123456789123:role/app"}, false},
+		{"ArnLike", []string{"arn:aws:iam::*:role/app"}, []string{"arn:aws:iam::123456789123:role/app"}, true},
+		{"ArnLike", []string{"arn:aws:iam::*"}, []string{"arn:aws:iam::123456789123:role/app"}, false},
+		{"ArnLike", []string{"arn:aws:s3:::*"}, []string{"arn:aws:s3:::bucket/a:b"}, true},
+		{"Null", []string{"true"}, nil, true},
+		{"Null", []string{"false"}, nil, false},
+		{"StringEqualsIfExists", []string{"a"}, nil, true},
+		{"ForAllValues:StringEquals", []string{"a", "b"}, []string{"a", "c"}, false},
+		{"ForAnyValue:StringEquals", []string{"a", "b"}, []string{"a", "c"}, true},
+	}
+
+	for _, tc := range tcs {
+		match, supported := conditionMatches(tc.operator, tc.policyValues, tc.requestValues)
+		assert.True(t, supported, "operator: %s", tc.operator)
+		assert.Equal(t, tc.expected, match, "operator: %s policy: %v request: %v", tc.operator, tc.policyValues, tc.requestValues)
+	}
+}
@@ -0,0 +1,32 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"time"
+)
+
+// PodIdentityAssociation is EKS Pod Identity association of kubernetes service account and IAM role
+type PodIdentityAssociation struct {
+	AssociationArn string
+	AssociationId  string
+	Namespace      string
+	ServiceAccount string
+	RoleArn        string
+	TargetRoleArn  string // set for cross account associations, role assumed by RoleArn
+	CreatedAt      time.Time
+	ModifiedAt     time.Time
+}
+
+func toPodIdentityAssociation(association *types.PodIdentityAssociation) PodIdentityAssociation {
+	return PodIdentityAssociation{
+		AssociationArn: aws.ToString(association.AssociationArn),
+		AssociationId:  aws.ToString(association.AssociationId),
+		Namespace:      aws.ToString(association.Namespace),
+		ServiceAccount: aws.ToString(association.ServiceAccount),
+		RoleArn:        aws.ToString(association.RoleArn),
+		TargetRoleArn:  aws.ToString(association.TargetRoleArn),
+		CreatedAt:      aws.ToTime(association.CreatedAt),
+		ModifiedAt:     aws.ToTime(association.ModifiedAt),
+	}
+}
@@ -0,0 +1,214 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+// PolicyDocument is parsed IAM policy document, either trust (assume role) policy or identity policy
+type PolicyDocument struct {
+	Version   string     `json:"Version"`
+	Id        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+// ParsePolicyDocument parses (already url decoded) IAM policy document
+func ParsePolicyDocument(document string) (PolicyDocument, error) {
+	var out PolicyDocument
+	if err := json.Unmarshal([]byte(document), &out); err != nil {
+		return PolicyDocument{}, fmt.Errorf("unmarshal policy document: %w", err)
+	}
+	return out, nil
+}
+
+type Statements []Statement
+
+// UnmarshalJSON handles statement set either as a single object or as a list of objects
+func (s *Statements) UnmarshalJSON(b []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "{") {
+		var statement Statement
+		if err := json.Unmarshal(b, &statement); err != nil {
+			return err
+		}
+		*s = Statements{statement}
+		return nil
+	}
+
+	var statements []Statement
+	if err := json.Unmarshal(b, &statements); err != nil {
+		return err
+	}
+	*s = statements
+	return nil
+}
+
+type Statement struct {
+	Sid          string     `json:"Sid,omitempty"`
+	Effect       string     `json:"Effect"`
+	Principal    Principal  `json:"Principal,omitzero"`
+	NotPrincipal Principal  `json:"NotPrincipal,omitzero"`
+	Action       Values     `json:"Action,omitempty"`
+	NotAction    Values     `json:"NotAction,omitempty"`
+	Resource     Values     `json:"Resource,omitempty"`
+	NotResource  Values     `json:"NotResource,omitempty"`
+	Condition    Conditions `json:"Condition,omitempty"`
+}
+
+// Name returns statement sid, or statement index if sid is not set
+func (s Statement) Name(index int) string {
+	if s.Sid != "" {
+		return s.Sid
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// IsAllow returns true if the statement effect is Allow
+func (s Statement) IsAllow() bool {
+	return strings.EqualFold(s.Effect, EffectAllow)
+}
+
+// IsDeny returns true if the statement effect is Deny
+func (s Statement) IsDeny() bool {
+	return strings.EqualFold(s.Effect, EffectDeny)
+}
+
+// MatchesAction returns true if the statement applies to supplied action (e.g. sts:AssumeRoleWithWebIdentity),
+// taking into account Action, NotAction and wildcards
+func (s Statement) MatchesAction(action string) bool {
+	if len(s.NotAction) != 0 {
+		return !matchAnyIgnoreCase(s.NotAction, action)
+	}
+	return matchAnyIgnoreCase(s.Action, action)
+}
+
+// Principal is statement principal, either "*" (Wildcard) or map of principal types (AWS, Federated, Service ...)
+type Principal struct {
+	Wildcard  bool
+	AWS       Values
+	Federated Values
+	Service   Values
+}
+
+func (p *Principal) UnmarshalJSON(b []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(b, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("unexpected principal %q", wildcard)
+		}
+		p.Wildcard = true
+		return nil
+	}
+
+	var principal struct {
+		AWS       Values `json:"AWS"`
+		Federated Values `json:"Federated"`
+		Service   Values `json:"Service"`
+	}
+	if err := json.Unmarshal(b, &principal); err != nil {
+		return err
+	}
+	p.AWS = principal.AWS
+	p.Federated = principal.Federated
+	p.Service = principal.Service
+	return nil
+}
+
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if p.Wildcard {
+		return json.Marshal("*")
+	}
+	principal := make(map[string]Values)
+	if len(p.AWS) != 0 {
+		principal["AWS"] = p.AWS
+	}
+	if len(p.Federated) != 0 {
+		principal["Federated"] = p.Federated
+	}
+	if len(p.Service) != 0 {
+		principal["Service"] = p.Service
+	}
+	return json.Marshal(principal)
+}
+
+// IsZero returns true if the principal is not set
+func (p Principal) IsZero() bool {
+	return !p.Wildcard && len(p.AWS) == 0 && len(p.Federated) == 0 && len(p.Service) == 0
+}
+
+// Conditions is statement condition block, condition operator (e.g. StringEquals) to condition key and values
+type Conditions map[string]map[string]Values
+
+// Values is a policy element that can be set either as a single value or as a list of values
+type Values []string
+
+func (v *Values) UnmarshalJSON(b []byte) error {
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	switch t := value.(type) {
+	case nil:
+		*v = nil
+	case []any:
+		out := make(Values, 0, len(t))
+		for _, item := range t {
+			out = append(out, fmt.Sprint(item))
+		}
+		*v = out
+	default:
+		*v = Values{fmt.Sprint(t)}
+	}
+	return nil
+}
+
+// MarshalJSON writes single value as a string, same as IAM does
+func (v Values) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+func matchAnyIgnoreCase(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches value against IAM pattern, where '*' matches any sequence of characters and '?' matches
+// any single character
+func matchWildcard(pattern, value string) bool {
+	var p, v, star, match int
+	star = -1
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star = p
+			match = v
+			p++
+		case star != -1:
+			p = star + 1
+			match++
+			v = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
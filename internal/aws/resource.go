@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resourceArnFormats are arn formats (partition, region, account, name) of LookupEvents resource types, resource names
+// of these types are not arns
+var resourceArnFormats = map[string]string{
+	"AWS::S3::Bucket":              "arn:%[1]s:s3:::%[4]s",
+	"AWS::DynamoDB::Table":         "arn:%[1]s:dynamodb:%[2]s:%[3]s:table/%[4]s",
+	"AWS::SQS::Queue":              "arn:%[1]s:sqs:%[2]s:%[3]s:%[4]s",
+	"AWS::Lambda::Function":        "arn:%[1]s:lambda:%[2]s:%[3]s:function:%[4]s",
+	"AWS::KMS::Key":                "arn:%[1]s:kms:%[2]s:%[3]s:key/%[4]s",
+	"AWS::IAM::Role":               "arn:%[1]s:iam::%[3]s:role/%[4]s",
+	"AWS::EC2::Instance":           "arn:%[1]s:ec2:%[2]s:%[3]s:instance/%[4]s",
+	"AWS::ECR::Repository":         "arn:%[1]s:ecr:%[2]s:%[3]s:repository/%[4]s",
+	"AWS::Kinesis::Stream":         "arn:%[1]s:kinesis:%[2]s:%[3]s:stream/%[4]s",
+	"AWS::SSM::Parameter":          "arn:%[1]s:ssm:%[2]s:%[3]s:parameter/%[4]s",
+	"AWS::Logs::LogGroup":          "arn:%[1]s:logs:%[2]s:%[3]s:log-group:%[4]s",
+	"AWS::SecretsManager::Secret":  "arn:%[1]s:secretsmanager:%[2]s:%[3]s:secret:%[4]s",
+	"AWS::StepFunctions::Activity": "arn:%[1]s:states:%[2]s:%[3]s:activity:%[4]s",
+}
+
+// resourceArn returns arn of LookupEvents resource, resource name is either arn, or name of known resource type in the
+// event region and account. Empty string is returned if the arn cannot be built.
+func resourceArn(resourceType, resourceName string, event Event) string {
+	if strings.HasPrefix(resourceName, "arn:") {
+		return resourceName
+	}
+	format, ok := resourceArnFormats[resourceType]
+	if !ok || resourceName == "" || event.Region == "" || event.RecipientAccountId == "" {
+		return ""
+	}
+	if resourceType == "AWS::SQS::Queue" {
+		// queue url e.g. https://sqs.eu-west-2.amazonaws.com/123456789123/queue
+		resourceName = resourceName[strings.LastIndex(resourceName, "/")+1:]
+	}
+	if resourceType == "AWS::SSM::Parameter" {
+		resourceName = strings.TrimPrefix(resourceName, "/")
+	}
+	return fmt.Sprintf(format, partitionForRegion(event.Region), event.Region, event.RecipientAccountId, resourceName)
+}
+
+// dataEventActions are IAM actions of CloudTrail data events (or calls that are not logged), these are not returned by
+// LookupEvents API
+var dataEventActions = []string{
+	"s3:GetObject", "s3:GetObjectVersion", "s3:GetObjectAcl", "s3:GetObjectTagging", "s3:GetObjectAttributes",
+	"s3:PutObject", "s3:PutObjectAcl", "s3:PutObjectTagging", "s3:DeleteObject", "s3:DeleteObjectVersion",
+	"s3:DeleteObjectTagging", "s3:ListBucket", "s3:ListBucketVersions", "s3:ListMultipartUploadParts",
+	"s3:AbortMultipartUpload", "s3:RestoreObject",
+	"dynamodb:GetItem", "dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:DeleteItem", "dynamodb:Query",
+	"dynamodb:Scan", "dynamodb:BatchGetItem", "dynamodb:BatchWriteItem", "dynamodb:ConditionCheckItem",
+	"dynamodb:PartiQLSelect", "dynamodb:PartiQLInsert", "dynamodb:PartiQLUpdate", "dynamodb:PartiQLDelete",
+	"dynamodb:GetRecords", "dynamodb:GetShardIterator",
+	"lambda:InvokeFunction",
+	"sqs:SendMessage", "sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:ChangeMessageVisibility",
+	"sns:Publish",
+	"kinesis:PutRecord", "kinesis:PutRecords", "kinesis:GetRecords", "kinesis:GetShardIterator",
+	"kinesis:SubscribeToShard",
+	"aps:RemoteWrite", "aps:QueryMetrics", "aps:GetSeries", "aps:GetLabels", "aps:GetMetricMetadata",
+}
+
+// isDataEventAction returns true if the action (or action pattern e.g. s3:Get*) matches any data event action
+func isDataEventAction(action string) bool {
+	for _, dataAction := range dataEventActions {
+		if matchAnyIgnoreCase([]string{action}, dataAction) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_resourceArn(t *testing.T) {
+	event := Event{Region: "eu-west-2", RecipientAccountId: "123456789123"}
+	tcs := []struct {
+		resourceType string
+		resourceName string
+		expected     string
+	}{
+		{"AWS::DynamoDB::Table", "orders", "arn:aws:dynamodb:eu-west-2:123456789123:table/orders"},
+		{"AWS::SQS::Queue", "https://sqs.eu-west-2.amazonaws.com/123456789123/jobs", "arn:aws:sqs:eu-west-2:123456789123:jobs"},
+		{"AWS::SSM::Parameter", "/app/config", "arn:aws:ssm:eu-west-2:123456789123:parameter/app/config"},
+		{"AWS::SNS::Topic", "arn:aws:sns:eu-west-2:123456789123:topic", "arn:aws:sns:eu-west-2:123456789123:topic"},
+		{"AWS::Unknown::Type", "name", ""},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, resourceArn(tc.resourceType, tc.resourceName, event), tc.resourceType)
+	}
+	assert.Empty(t, resourceArn("AWS::S3::Bucket", "bucket", Event{}))
+}
+
+func Test_isDataEventAction(t *testing.T) {
+	assert.True(t, isDataEventAction("s3:GetObject"))
+	assert.True(t, isDataEventAction("s3:Get*"))
+	assert.True(t, isDataEventAction("dynamodb:*"))
+	assert.False(t, isDataEventAction("s3:GetBucketPolicy"))
+	assert.False(t, isDataEventAction("sts:GetCallerIdentity"))
+}
@@ -0,0 +1,230 @@
+package aws
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+var severities = []Severity{SeverityLow, SeverityMedium, SeverityHigh}
+
+// ParseSeverity parses case-insensitive severity name
+func ParseSeverity(v string) (Severity, error) {
+	for _, severity := range severities {
+		if strings.EqualFold(v, string(severity)) {
+			return severity, nil
+		}
+	}
+	return "", fmt.Errorf("invalid severity %q, valid values are low, medium and high", v)
+}
+
+// AtLeast returns true if the severity is the same or higher than supplied severity
+func (s Severity) AtLeast(severity Severity) bool {
+	return slices.Index(severities, s) >= slices.Index(severities, severity)
+}
+
+type TrustRiskCheck string
+
+const (
+	TrustRiskMissingSub       TrustRiskCheck = "missing sub"
+	TrustRiskWildcardSub      TrustRiskCheck = "wildcard sub"
+	TrustRiskMissingAud       TrustRiskCheck = "missing aud"
+	TrustRiskMultipleClusters TrustRiskCheck = "multiple clusters"
+	TrustRiskPrincipal        TrustRiskCheck = "principal"
+)
+
+// TrustRisk is over-permissive trust policy pattern, Statement is empty if the risk applies to the whole policy
+type TrustRisk struct {
+	Severity  Severity
+	Check     TrustRiskCheck
+	Statement string
+	Message   string
+}
+
+func (t TrustRisk) String() string {
+	if t.Statement == "" {
+		return fmt.Sprintf("%s: %s", t.Check, t.Message)
+	}
+	return fmt.Sprintf("statement %s: %s: %s", t.Statement, t.Check, t.Message)
+}
+
+// MaxSeverity returns the highest severity of the risks, empty if there are no risks
+func MaxSeverity(risks []TrustRisk) Severity {
+	var out Severity
+	for _, risk := range risks {
+		if out == "" || risk.Severity.AtLeast(out) {
+			out = risk.Severity
+		}
+	}
+	return out
+}
+
+// TrustPolicyRisks parses trust policy and returns its risks
+func TrustPolicyRisks(document string) ([]TrustRisk, error) {
+	policy, err := ParsePolicyDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	return policy.TrustRisks(), nil
+}
+
+var accountIdRegexp = regexp.MustCompile(`^\d{12}$`)
+
+// TrustRisks returns over-permissive patterns in web identity (IRSA) trust policy: web identity statements without
+// sub or aud conditions, sub conditions with wildcards, providers of multiple clusters, and wildcard or account root
+// principals alongside the federated principal. Policies without web identity statements do not have risks.
+func (p PolicyDocument) TrustRisks() []TrustRisk {
+	providers := p.WebIdentityProviders()
+	if len(providers) == 0 {
+		return nil
+	}
+
+	var out []TrustRisk
+	for i, statement := range p.Statement {
+		if !statement.IsAllow() {
+			continue
+		}
+		name := statement.Name(i)
+		out = append(out, statement.principalRisks(name)...)
+		if !statement.MatchesAction(ActionAssumeRoleWithWebIdentity) {
+			continue
+		}
+		for _, federated := range statement.Principal.Federated {
+			out = append(out, statement.webIdentityRisks(name, federated)...)
+		}
+	}
+
+	var eksProviders []string
+	for _, provider := range providers {
+		if _, _, ok := EksOidcProvider(provider); ok {
+			eksProviders = append(eksProviders, provider)
+		}
+	}
+	if len(eksProviders) > 1 {
+		out = append(out, TrustRisk{
+			Severity: SeverityMedium,
+			Check:    TrustRiskMultipleClusters,
+			Message:  fmt.Sprintf("role trusts %d cluster oidc providers %s, compromise of any cluster grants the role", len(eksProviders), strings.Join(eksProviders, ", ")),
+		})
+	}
+	return out
+}
+
+func (s Statement) principalRisks(name string) []TrustRisk {
+	if s.Principal.Wildcard || slices.Contains(s.Principal.AWS, "*") {
+		return []TrustRisk{{
+			Severity:  SeverityHigh,
+			Check:     TrustRiskPrincipal,
+			Statement: name,
+			Message:   "principal * allows any AWS principal to assume the role",
+		}}
+	}
+	var out []TrustRisk
+	for _, principal := range s.Principal.AWS {
+		if accountIdRegexp.MatchString(principal) || strings.HasSuffix(principal, ":root") {
+			out = append(out, TrustRisk{
+				Severity:  SeverityMedium,
+				Check:     TrustRiskPrincipal,
+				Statement: name,
+				Message:   fmt.Sprintf("account root principal %s allows any principal in the account with sts:AssumeRole permission to assume the role", principal),
+			})
+		}
+	}
+	return out
+}
+
+func (s Statement) webIdentityRisks(name, federated string) []TrustRisk {
+	_, issuer, ok := strings.Cut(federated, ":oidc-provider/")
+	if !ok {
+		return nil
+	}
+
+	var out []TrustRisk
+	sub, aud := s.claimConditions(issuer, "sub"), s.claimConditions(issuer, "aud")
+	if !slices.ContainsFunc(slices.Collect(maps.Keys(sub)), restrictsSubject) {
+		out = append(out, TrustRisk{
+			Severity:  SeverityHigh,
+			Check:     TrustRiskMissingSub,
+			Statement: name,
+			Message:   fmt.Sprintf("no %s:sub StringEquals or StringLike condition, any service account in the cluster can assume the role", issuer),
+		})
+	}
+	for operator, values := range sub {
+		if !strings.EqualFold(baseOperator(operator), "StringLike") {
+			continue
+		}
+		for _, value := range values {
+			if severity, msg, ok := subjectWildcardRisk(value); ok {
+				out = append(out, TrustRisk{Severity: severity, Check: TrustRiskWildcardSub, Statement: name, Message: msg})
+			}
+		}
+	}
+	if len(aud) == 0 {
+		out = append(out, TrustRisk{
+			Severity:  SeverityLow,
+			Check:     TrustRiskMissingAud,
+			Statement: name,
+			Message:   fmt.Sprintf("no %s:aud condition, tokens with any audience in provider client ids are accepted", issuer),
+		})
+	}
+	slices.SortFunc(out, func(a, b TrustRisk) int { return strings.Compare(a.Message, b.Message) })
+	return out
+}
+
+// baseOperator returns condition operator without ForAnyValue:/ForAllValues: set operator prefix and IfExists suffix
+func baseOperator(operator string) string {
+	if _, after, ok := strings.Cut(operator, ":"); ok {
+		operator = after
+	}
+	return strings.TrimSuffix(operator, "IfExists")
+}
+
+// restrictsSubject returns true for StringEquals and StringLike operators, negated operators (e.g. StringNotEquals)
+// exclude some subjects and allow all the others, so they do not restrict the subject
+func restrictsSubject(operator string) bool {
+	base := baseOperator(operator)
+	return strings.EqualFold(base, "StringEquals") || strings.EqualFold(base, "StringLike")
+}
+
+// claimConditions returns condition operators and values for the issuer claim condition key (e.g. <issuer>:sub)
+func (s Statement) claimConditions(issuer, claim string) map[string]Values {
+	out := make(map[string]Values)
+	for operator, conditions := range s.Condition {
+		for key, values := range conditions {
+			if strings.EqualFold(key, fmt.Sprintf("%s:%s", issuer, claim)) {
+				out[operator] = append(out[operator], values...)
+			}
+		}
+	}
+	return out
+}
+
+// subjectWildcardRisk returns risk of sub condition value with wildcards, e.g. system:serviceaccount:* matches any
+// service account, system:serviceaccount:*:app matches service account in any namespace
+func subjectWildcardRisk(value string) (Severity, string, bool) {
+	if !strings.ContainsAny(value, "*?") {
+		return "", "", false
+	}
+	rest, ok := strings.CutPrefix(value, "system:serviceaccount:")
+	if !ok {
+		return SeverityHigh, fmt.Sprintf("sub %s matches any subject", value), true
+	}
+	namespace, name, ok := strings.Cut(rest, ":")
+	if !ok {
+		return SeverityHigh, fmt.Sprintf("sub %s matches any service account", value), true
+	}
+	if strings.ContainsAny(namespace, "*?") {
+		return SeverityMedium, fmt.Sprintf("sub %s matches service account %s in any matching namespace", value, name), true
+	}
+	return SeverityLow, fmt.Sprintf("sub %s matches any matching service account in %s namespace", value, namespace), true
+}
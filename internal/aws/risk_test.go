@@ -0,0 +1,123 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTrustPolicyRisks(t *testing.T) {
+	t.Run("scoped policy", func(t *testing.T) {
+		risks, err := TrustPolicyRisks(testTrustPolicy)
+		require.NoError(t, err)
+		assert.Empty(t, risks)
+	})
+
+	t.Run("missing conditions", func(t *testing.T) {
+		risks, err := TrustPolicyRisks(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			"Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}}}`)
+		require.NoError(t, err)
+		require.Len(t, risks, 2)
+		assert.Equal(t, TrustRiskMissingSub, risks[1].Check)
+		assert.Equal(t, SeverityHigh, risks[1].Severity)
+		assert.Equal(t, TrustRiskMissingAud, risks[0].Check)
+		assert.Equal(t, SeverityHigh, MaxSeverity(risks))
+	})
+
+	t.Run("wildcard sub", func(t *testing.T) {
+		tcs := []struct {
+			sub      string
+			severity Severity
+		}{
+			{"system:serviceaccount:*", SeverityHigh},
+			{"*", SeverityHigh},
+			{"system:serviceaccount:*:app", SeverityMedium},
+			{"system:serviceaccount:team-*:app", SeverityMedium},
+			{"system:serviceaccount:default:app-*", SeverityLow},
+		}
+		for _, tc := range tcs {
+			risks, err := TrustPolicyRisks(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+				"Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"},
+				"Condition": {"StringLike": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "` + tc.sub + `"},
+				"StringEquals": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:aud": "sts.amazonaws.com"}}}}`)
+			require.NoError(t, err)
+			require.Len(t, risks, 1, "sub: %s", tc.sub)
+			assert.Equal(t, TrustRiskWildcardSub, risks[0].Check)
+			assert.Equal(t, tc.severity, risks[0].Severity, "sub: %s", tc.sub)
+		}
+	})
+
+	t.Run("wildcard sub operators", func(t *testing.T) {
+		tcs := []struct {
+			operator string
+			risk     bool
+		}{
+			{"StringLike", true},
+			{"StringLikeIfExists", true},
+			{"ForAnyValue:StringLike", true},
+			{"ForAllValues:StringLike", true},
+			{"StringNotLike", false},
+			{"ForAnyValue:StringNotLike", false},
+		}
+		for _, tc := range tcs {
+			risks, err := TrustPolicyRisks(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+				"Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"},
+				"Condition": {"` + tc.operator + `": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:kube-system:*"},
+				"StringEquals": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:aud": "sts.amazonaws.com"}}}}`)
+			require.NoError(t, err)
+			assert.Equal(t, tc.risk, len(risks) == 1 && risks[0].Check == TrustRiskWildcardSub, "operator: %s", tc.operator)
+		}
+	})
+
+	t.Run("negated sub only", func(t *testing.T) {
+		for _, operator := range []string{"StringNotEquals", "StringNotLike", "ForAnyValue:StringNotLike"} {
+			risks, err := TrustPolicyRisks(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+				"Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"},
+				"Condition": {"` + operator + `": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:kube-system:admin"},
+				"StringEquals": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:aud": "sts.amazonaws.com"}}}}`)
+			require.NoError(t, err)
+			require.Len(t, risks, 1, "operator: %s", operator)
+			assert.Equal(t, TrustRiskMissingSub, risks[0].Check, "operator: %s", operator)
+			assert.Equal(t, SeverityHigh, risks[0].Severity)
+		}
+	})
+
+	t.Run("multiple clusters and principals", func(t *testing.T) {
+		risks, err := TrustPolicyRisks(`{"Statement": [
+			{"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity", "Principal": {"Federated": [
+				"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC",
+				"arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-1.amazonaws.com/id/XYZ"]},
+				"Condition": {"StringEquals": {
+					"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:default:app",
+					"oidc.eks.eu-west-2.amazonaws.com/id/ABC:aud": "sts.amazonaws.com",
+					"oidc.eks.eu-west-1.amazonaws.com/id/XYZ:sub": "system:serviceaccount:default:app",
+					"oidc.eks.eu-west-1.amazonaws.com/id/XYZ:aud": "sts.amazonaws.com"}}},
+			{"Sid": "Root", "Effect": "Allow", "Action": "sts:AssumeRole", "Principal": {"AWS": "arn:aws:iam::123456789123:root"}},
+			{"Sid": "Any", "Effect": "Allow", "Action": "sts:AssumeRole", "Principal": "*"}]}`)
+		require.NoError(t, err)
+		require.Len(t, risks, 3)
+		assert.Equal(t, TrustRisk{Severity: SeverityMedium, Check: TrustRiskPrincipal, Statement: "Root",
+			Message: "account root principal arn:aws:iam::123456789123:root allows any principal in the account with sts:AssumeRole permission to assume the role"}, risks[0])
+		assert.Equal(t, SeverityHigh, risks[1].Severity)
+		assert.Equal(t, "Any", risks[1].Statement)
+		assert.Equal(t, TrustRiskMultipleClusters, risks[2].Check)
+	})
+
+	t.Run("not web identity role", func(t *testing.T) {
+		risks, err := TrustPolicyRisks(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Principal": "*"}}`)
+		require.NoError(t, err)
+		assert.Empty(t, risks)
+	})
+}
+
+func TestSeverity_AtLeast(t *testing.T) {
+	assert.True(t, SeverityHigh.AtLeast(SeverityMedium))
+	assert.True(t, SeverityMedium.AtLeast(SeverityMedium))
+	assert.False(t, SeverityLow.AtLeast(SeverityMedium))
+
+	severity, err := ParseSeverity("HIGH")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityHigh, severity)
+	_, err = ParseSeverity("critical")
+	assert.Error(t, err)
+}
@@ -3,8 +3,10 @@ package aws
 import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -13,10 +15,35 @@ type Role struct {
 	Name                     string
 	Description              string
 	AssumeRolePolicyDocument string
+	PermissionsBoundaryArn   string
 	CreateDate               time.Time
 	RoleLastUsed             time.Time
 }
 
+// Policy is managed (attached, permissions boundary) or inline role policy, Arn and VersionId are empty for inline
+// policies, Document is url decoded default version of the policy
+type Policy struct {
+	Name      string
+	Arn       string
+	VersionId string
+	Document  string
+}
+
+// String returns managed policy arn, or inline policy name
+func (p Policy) String() string {
+	if p.Arn != "" {
+		return p.Arn
+	}
+	return fmt.Sprintf("%s (inline)", p.Name)
+}
+
+// RolePolicies are permission policies of the role, PermissionsBoundary is nil if the role does not have one
+type RolePolicies struct {
+	Attached            []Policy
+	Inline              []Policy
+	PermissionsBoundary *Policy
+}
+
 func (c Client) toRole(role *types.Role) Role {
 	roleName := aws.ToString(role.RoleName)
 	document, err := url.QueryUnescape(aws.ToString(role.AssumeRolePolicyDocument))
@@ -24,12 +51,55 @@ func (c Client) toRole(role *types.Role) Role {
 		c.logger.Warn(fmt.Sprintf("unescape %s assume role policy: %v", roleName, err))
 	}
 
-	return Role{
+	var permissionsBoundaryArn string
+	if role.PermissionsBoundary != nil {
+		permissionsBoundaryArn = aws.ToString(role.PermissionsBoundary.PermissionsBoundaryArn)
+	}
+
+	out := Role{
 		ARN:                      aws.ToString(role.Arn),
 		Name:                     roleName,
 		Description:              aws.ToString(role.Description),
 		AssumeRolePolicyDocument: document,
+		PermissionsBoundaryArn:   permissionsBoundaryArn,
 		CreateDate:               aws.ToTime(role.CreateDate),
-		RoleLastUsed:             aws.ToTime(role.RoleLastUsed.LastUsedDate),
 	}
+	if role.RoleLastUsed != nil {
+		out.RoleLastUsed = aws.ToTime(role.RoleLastUsed.LastUsedDate)
+	}
+	return out
+}
+
+func (c Client) toPolicy(name, policyArn, versionId, document string) Policy {
+	unescaped, err := url.QueryUnescape(document)
+	if err != nil {
+		c.logger.Warn(fmt.Sprintf("unescape %s policy: %v", name, err))
+	}
+	return Policy{
+		Name:      name,
+		Arn:       policyArn,
+		VersionId: versionId,
+		Document:  unescaped,
+	}
+}
+
+// ValidateRoleArn returns error if the supplied arn is not a valid IAM role arn
+func ValidateRoleArn(roleArn string) error {
+	if roleArn == "" {
+		return fmt.Errorf("role arn is empty")
+	}
+	a, err := arn.Parse(roleArn)
+	if err != nil {
+		return fmt.Errorf("role arn %s: %w", roleArn, err)
+	}
+	if a.Service != "iam" {
+		return fmt.Errorf("role arn %s: unexpected service %s, expected iam", roleArn, a.Service)
+	}
+	if a.AccountID == "" {
+		return fmt.Errorf("role arn %s: account id is empty", roleArn)
+	}
+	if !strings.HasPrefix(a.Resource, "role/") || strings.TrimPrefix(a.Resource, "role/") == "" {
+		return fmt.Errorf("role arn %s: unexpected resource %s, expected role/<name>", roleArn, a.Resource)
+	}
+	return nil
 }
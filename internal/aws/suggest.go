@@ -0,0 +1,199 @@
+package aws
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	policyVersion = "2012-10-17"
+	// maxResources is maximum number of resources with the same parent listed in a statement, resources over the
+	// limit are replaced by parent arn pattern e.g. arn:aws:s3:::bucket/*
+	maxResources = 5
+)
+
+// eventActions are CloudTrail event names that are authorized by different IAM action
+var eventActions = map[string]string{
+	"s3:HeadBucket":              "s3:ListBucket",
+	"s3:HeadObject":              "s3:GetObject",
+	"s3:ListObjects":             "s3:ListBucket",
+	"s3:ListObjectsV2":           "s3:ListBucket",
+	"s3:ListObjectVersions":      "s3:ListBucketVersions",
+	"s3:CreateMultipartUpload":   "s3:PutObject",
+	"s3:UploadPart":              "s3:PutObject",
+	"s3:CompleteMultipartUpload": "s3:PutObject",
+	"s3:CopyObject":              "s3:PutObject",
+	"s3:DeleteObjects":           "s3:DeleteObject",
+}
+
+// eventSourcePrefixes are CloudTrail event sources with IAM action prefix different from the event source host
+var eventSourcePrefixes = map[string]string{
+	"monitoring.amazonaws.com":    "cloudwatch",
+	"email.amazonaws.com":         "ses",
+	"tagging.amazonaws.com":       "tag",
+	"appconfigdata.amazonaws.com": "appconfig",
+	"models.lex.amazonaws.com":    "lex",
+	"runtime.lex.amazonaws.com":   "lex",
+}
+
+// IAMAction returns IAM action that authorizes the event e.g. s3:GetObject. CloudTrail event names mostly match IAM
+// actions, known exceptions (e.g. s3 ListObjectsV2 requires s3:ListBucket, monitoring.amazonaws.com event source
+// is cloudwatch prefix) are mapped.
+func (e Event) IAMAction() string {
+	prefix := cmp.Or(eventSourcePrefixes[e.EventSource], eventService(e.EventSource))
+	action := fmt.Sprintf("%s:%s", prefix, e.EventName)
+	return cmp.Or(eventActions[action], action)
+}
+
+// ResourceArns returns distinct arns of the event resources
+func (e Event) ResourceArns() []string {
+	var out []string
+	for _, resource := range e.Resources {
+		if resource.ARN != "" && !slices.Contains(out, resource.ARN) {
+			out = append(out, resource.ARN)
+		}
+	}
+	return out
+}
+
+// ObservedPermission is IAM action used by successful API calls, Resources are resource arns of the calls, or "*" if
+// CloudTrail does not record resources for the action
+type ObservedPermission struct {
+	Action    string
+	Resources []string
+}
+
+// ObservedPermissions returns IAM actions and resources of successful API calls, sorted by action. Failed calls are
+// not included, because they were not allowed.
+func (e Events) ObservedPermissions() []ObservedPermission {
+	resources := make(map[string][]string)
+	for _, event := range e {
+		if event.Failed() || event.EventSource == "" || event.EventName == "" {
+			continue
+		}
+		action := event.IAMAction()
+		arns := event.ResourceArns()
+		if len(arns) == 0 {
+			arns = []string{"*"}
+		}
+		for _, arn := range arns {
+			if !slices.Contains(resources[action], arn) {
+				resources[action] = append(resources[action], arn)
+			}
+		}
+	}
+
+	out := make([]ObservedPermission, 0, len(resources))
+	for action, arns := range resources {
+		out = append(out, ObservedPermission{Action: action, Resources: resourcePatterns(arns)})
+	}
+	slices.SortFunc(out, func(a, b ObservedPermission) int { return cmp.Compare(a.Action, b.Action) })
+	return out
+}
+
+// SuggestPolicy returns minimal identity policy that allows observed permissions, actions with the same resources are
+// grouped in one statement
+func SuggestPolicy(permissions []ObservedPermission) PolicyDocument {
+	statements := Statements{}
+	index := make(map[string]int)
+	for _, permission := range permissions {
+		key := strings.Join(permission.Resources, ",")
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(statements)
+			statements = append(statements, Statement{Effect: EffectAllow, Resource: permission.Resources})
+			i = len(statements) - 1
+		}
+		statements[i].Action = append(statements[i].Action, permission.Action)
+	}
+	for i := range statements {
+		slices.Sort(statements[i].Action)
+	}
+	slices.SortStableFunc(statements, func(a, b Statement) int { return cmp.Compare(a.Action[0], b.Action[0]) })
+	return PolicyDocument{Version: policyVersion, Statement: statements}
+}
+
+// resourcePatterns returns sorted resources, if there is "*" resource, only "*" is returned. Resources with the same
+// parent (arn up to the last '/' or ':') over maxResources limit are replaced by parent pattern.
+func resourcePatterns(arns []string) []string {
+	if slices.Contains(arns, "*") {
+		return []string{"*"}
+	}
+
+	parents := make(map[string][]string)
+	for _, arn := range arns {
+		parent := arn[:strings.LastIndexAny(arn, "/:")+1]
+		parents[parent] = append(parents[parent], arn)
+	}
+
+	var out []string
+	for parent, children := range parents {
+		if len(children) > maxResources && strings.Count(parent, ":") >= 5 {
+			out = append(out, parent+"*")
+			continue
+		}
+		out = append(out, children...)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// UnusedPermission is action pattern in Allow statement of the role policy that does not match any observed action
+type UnusedPermission struct {
+	Policy    string
+	Statement string
+	Action    string
+}
+
+// PolicyDiff is difference between the role policies and observed permissions. Unused are allowed actions that were
+// not used, Missing are observed permissions that are not allowed by the current policies (e.g. allowed by resource
+// policy or by condition that cannot be evaluated) and Notes are statements that could not be compared.
+type PolicyDiff struct {
+	Unused  []UnusedPermission
+	Missing []ObservedPermission
+	Notes   []string
+}
+
+// DiffPolicies compares attached and inline role policies with observed permissions. Permissions boundary is not
+// compared, because it does not grant permissions. If data events are not observed (LookupEvents API), actions that
+// match data event actions (e.g. s3:GetObject) are not reported as unused.
+func DiffPolicies(policies RolePolicies, permissions []ObservedPermission, dataEvents bool) PolicyDiff {
+	var out PolicyDiff
+	for _, policy := range append(slices.Clone(policies.Attached), policies.Inline...) {
+		document, err := ParsePolicyDocument(policy.Document)
+		if err != nil {
+			out.Notes = append(out.Notes, fmt.Sprintf("policy %s: %v", policy, err))
+			continue
+		}
+		for i, statement := range document.Statement {
+			if !statement.IsAllow() {
+				continue
+			}
+			if len(statement.NotAction) != 0 {
+				out.Notes = append(out.Notes, fmt.Sprintf("policy %s statement %s: NotAction is not compared", policy, statement.Name(i)))
+				continue
+			}
+			for _, action := range statement.Action {
+				used := slices.ContainsFunc(permissions, func(p ObservedPermission) bool { return matchAnyIgnoreCase([]string{action}, p.Action) })
+				if !used && (dataEvents || !isDataEventAction(action)) {
+					out.Unused = append(out.Unused, UnusedPermission{Policy: policy.String(), Statement: statement.Name(i), Action: action})
+				}
+			}
+		}
+	}
+
+	for _, permission := range permissions {
+		var missing []string
+		for _, resource := range permission.Resources {
+			if !EvaluatePermission(policies, PermissionRequest{Action: permission.Action, Resource: resource}).Allowed() {
+				missing = append(missing, resource)
+			}
+		}
+		if len(missing) != 0 {
+			out.Missing = append(out.Missing, ObservedPermission{Action: permission.Action, Resources: missing})
+		}
+	}
+	return out
+}
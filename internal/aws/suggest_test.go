@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEvents_ObservedPermissions(t *testing.T) {
+	s3Event := func(name, arn, errorCode string) Event {
+		return Event{EventSource: "s3.amazonaws.com", EventName: name, ErrorCode: errorCode, Resources: []EventResource{{ARN: arn}}}
+	}
+	events := Events{
+		s3Event("GetObject", "arn:aws:s3:::bucket/a", ""),
+		s3Event("HeadObject", "arn:aws:s3:::bucket/b", ""),
+		s3Event("GetObject", "arn:aws:s3:::bucket/a", ""),
+		s3Event("ListObjectsV2", "arn:aws:s3:::bucket", ""),
+		s3Event("PutObject", "arn:aws:s3:::bucket/c", "AccessDenied"),
+		{EventSource: "sts.amazonaws.com", EventName: "GetCallerIdentity"},
+		{EventSource: "monitoring.amazonaws.com", EventName: "PutMetricData"},
+		{EventSource: "email.amazonaws.com", EventName: "SendEmail"},
+	}
+
+	assert.Equal(t, []ObservedPermission{
+		{Action: "cloudwatch:PutMetricData", Resources: []string{"*"}},
+		{Action: "s3:GetObject", Resources: []string{"arn:aws:s3:::bucket/a", "arn:aws:s3:::bucket/b"}},
+		{Action: "s3:ListBucket", Resources: []string{"arn:aws:s3:::bucket"}},
+		{Action: "ses:SendEmail", Resources: []string{"*"}},
+		{Action: "sts:GetCallerIdentity", Resources: []string{"*"}},
+	}, events.ObservedPermissions())
+}
+
+func Test_resourcePatterns(t *testing.T) {
+	var objects []string
+	for i := range maxResources + 1 {
+		objects = append(objects, fmt.Sprintf("arn:aws:s3:::bucket/%d", i))
+	}
+	assert.Equal(t, []string{"arn:aws:s3:::bucket/*", "arn:aws:s3:::other/a"}, resourcePatterns(append(objects, "arn:aws:s3:::other/a")))
+	assert.Equal(t, []string{"*"}, resourcePatterns([]string{"arn:aws:s3:::bucket/a", "*"}))
+	assert.Equal(t, objects[:2], resourcePatterns(objects[:2]))
+}
+
+func TestSuggestPolicy(t *testing.T) {
+	policy := SuggestPolicy([]ObservedPermission{
+		{Action: "s3:GetObject", Resources: []string{"arn:aws:s3:::bucket/*"}},
+		{Action: "s3:PutObject", Resources: []string{"arn:aws:s3:::bucket/*"}},
+		{Action: "sqs:ReceiveMessage", Resources: []string{"*"}},
+	})
+	b, err := json.Marshal(policy)
+	require.NoError(t, err)
+	expected := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::bucket/*"},{"Effect":"Allow","Action":"sqs:ReceiveMessage","Resource":"*"}]}`
+	assert.JSONEq(t, expected, string(b))
+}
+
+func TestDiffPolicies(t *testing.T) {
+	policies := RolePolicies{
+		Attached: []Policy{{Arn: "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess", Document: `{"Statement":[{"Effect":"Allow","Action":["s3:Get*","s3:List*"],"Resource":"*"}]}`}},
+		Inline: []Policy{
+			{Name: "sqs", Document: `{"Statement":{"Effect":"Allow","Action":"sqs:*","Resource":"arn:aws:sqs:eu-west-2:123456789123:queue"}}`},
+			{Name: "other", Document: `{"Statement":{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}}`},
+		},
+	}
+	permissions := []ObservedPermission{
+		{Action: "s3:GetObject", Resources: []string{"arn:aws:s3:::bucket/a"}},
+		{Action: "sqs:SendMessage", Resources: []string{"arn:aws:sqs:eu-west-2:123456789123:other"}},
+	}
+
+	diff := DiffPolicies(policies, permissions, true)
+	assert.Equal(t, []UnusedPermission{{Policy: "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess", Statement: "#0", Action: "s3:List*"}}, diff.Unused)
+	assert.Empty(t, diff.Missing)
+	assert.Equal(t, []string{"policy other (inline) statement #0: NotAction is not compared"}, diff.Notes)
+
+	// s3:List* matches data event s3:ListBucket, which is not observed by LookupEvents API
+	diff = DiffPolicies(policies, permissions, false)
+	assert.Empty(t, diff.Unused)
+
+	diff = DiffPolicies(RolePolicies{Inline: policies.Inline[:1]}, permissions, true)
+	// sqs:SendMessage on other queue was allowed only by NotAction statement
+	assert.Equal(t, permissions, diff.Missing)
+}
@@ -0,0 +1,231 @@
+package aws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Token is decoded (not verified) service account JWT token
+type Token struct {
+	Header       TokenHeader
+	Claims       TokenClaims
+	signingInput string
+	signature    []byte
+}
+
+type TokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type TokenClaims struct {
+	Issuer     string            `json:"iss"`
+	Subject    string            `json:"sub"`
+	Audience   Values            `json:"aud"`
+	ExpiresAt  int64             `json:"exp"`
+	IssuedAt   int64             `json:"iat"`
+	NotBefore  int64             `json:"nbf"`
+	Kubernetes *KubernetesClaims `json:"kubernetes.io"`
+}
+
+// KubernetesClaims are kubernetes.io claims, Pod and Node are set only for tokens bound to a pod
+type KubernetesClaims struct {
+	Namespace      string            `json:"namespace"`
+	ServiceAccount KubernetesObject  `json:"serviceaccount"`
+	Pod            *KubernetesObject `json:"pod"`
+	Node           *KubernetesObject `json:"node"`
+}
+
+type KubernetesObject struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+func (c TokenClaims) ExpiresAtTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+func (c TokenClaims) IssuedAtTime() time.Time {
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// ParseToken decodes JWT token header and claims, signature is not verified
+func ParseToken(raw string) (Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return Token{}, fmt.Errorf("token has %d parts, expected 3", len(parts))
+	}
+
+	var token Token
+	if err := decodeTokenPart(parts[0], &token.Header); err != nil {
+		return Token{}, fmt.Errorf("token header: %w", err)
+	}
+	if err := decodeTokenPart(parts[1], &token.Claims); err != nil {
+		return Token{}, fmt.Errorf("token claims: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Token{}, fmt.Errorf("token signature: %w", err)
+	}
+	token.signingInput = parts[0] + "." + parts[1]
+	token.signature = signature
+	return token, nil
+}
+
+func decodeTokenPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Verify verifies token signature with the JWKS key that has the token kid (or with any key if the token does not have
+// kid), and returns the key that verified the signature
+func (t Token) Verify(jwks JWKS) (JWK, error) {
+	var errs []error
+	for _, key := range jwks.Keys {
+		if t.Header.Kid != "" && key.Kid != t.Header.Kid {
+			continue
+		}
+		if err := key.verify(t.Header.Alg, t.signingInput, t.signature); err != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", key.Kid, err))
+			continue
+		}
+		return key, nil
+	}
+	if len(errs) == 0 {
+		return JWK{}, fmt.Errorf("key %s not found in jwks", t.Header.Kid)
+	}
+	return JWK{}, errors.Join(errs...)
+}
+
+// WebIdentity returns the identity that STS sees when the token is used in AssumeRoleWithWebIdentity, provider arn
+// is the token issuer provider in the cluster account
+func (t Token) WebIdentity(cluster Cluster) WebIdentity {
+	cluster.OidcIssuer = t.Claims.Issuer
+	var audience string
+	if len(t.Claims.Audience) != 0 {
+		audience = t.Claims.Audience[0]
+	}
+	return WebIdentity{
+		ProviderArn: cluster.OidcProviderArn(),
+		Issuer:      cluster.OidcIssuerHost(),
+		Subject:     t.Claims.Subject,
+		Audience:    audience,
+	}
+}
+
+// HasAudience returns true if the token aud claim contains the audience
+func (c TokenClaims) HasAudience(audience string) bool {
+	return slices.Contains(c.Audience, audience)
+}
+
+// JWKS is JSON web key set published by the oidc issuer
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is RSA or EC public JSON web key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k JWK) verify(alg, signingInput string, signature []byte) error {
+	hash, err := algHash(alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS") && k.Kty == "RSA":
+		publicKey, err := k.rsaPublicKey()
+		if err != nil {
+			return err
+		}
+		return rsa.VerifyPKCS1v15(publicKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "ES") && k.Kty == "EC":
+		publicKey, err := k.ecdsaPublicKey()
+		if err != nil {
+			return err
+		}
+		size := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return errors.New("ecdsa verification error")
+		}
+		return nil
+	}
+	return fmt.Errorf("algorithm %s does not match %s key", alg, k.Kty)
+}
+
+func algHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "ES512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+func (k JWK) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func (k JWK) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
@@ -0,0 +1,100 @@
+package aws
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+)
+
+func TestParseToken(t *testing.T) {
+	t.Run("audience list", func(t *testing.T) {
+		token, err := ParseToken(testUnsignedToken(t, `{"iss": "https://oidc.eks.eu-west-2.amazonaws.com/id/ABC", "aud": ["sts.amazonaws.com", "other"],
+			"sub": "system:serviceaccount:default:app", "exp": 1767225600, "kubernetes.io": {"namespace": "default",
+			"serviceaccount": {"name": "app", "uid": "123"}, "pod": {"name": "app-1", "uid": "456"}}}`))
+		require.NoError(t, err)
+		assert.Equal(t, "https://oidc.eks.eu-west-2.amazonaws.com/id/ABC", token.Claims.Issuer)
+		assert.True(t, token.Claims.HasAudience("sts.amazonaws.com"))
+		assert.Equal(t, int64(1767225600), token.Claims.ExpiresAtTime().Unix())
+		require.NotNil(t, token.Claims.Kubernetes)
+		assert.Equal(t, "app", token.Claims.Kubernetes.ServiceAccount.Name)
+		require.NotNil(t, token.Claims.Kubernetes.Pod)
+		assert.Equal(t, "app-1", token.Claims.Kubernetes.Pod.Name)
+	})
+
+	t.Run("audience string", func(t *testing.T) {
+		token, err := ParseToken(testUnsignedToken(t, `{"aud": "sts.amazonaws.com"}`))
+		require.NoError(t, err)
+		assert.Equal(t, Values{"sts.amazonaws.com"}, token.Claims.Audience)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseToken("header.claims")
+		assert.Error(t, err)
+	})
+}
+
+func TestToken_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Kid: "test",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	raw := testSignedToken(t, key, "test", `{"sub": "system:serviceaccount:default:app"}`)
+
+	t.Run("valid", func(t *testing.T) {
+		token, err := ParseToken(raw)
+		require.NoError(t, err)
+		verifiedWith, err := token.Verify(jwks)
+		require.NoError(t, err)
+		assert.Equal(t, "test", verifiedWith.Kid)
+	})
+
+	t.Run("tampered claims", func(t *testing.T) {
+		token, err := ParseToken(raw)
+		require.NoError(t, err)
+		token.signingInput += "x"
+		_, err = token.Verify(jwks)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		token, err := ParseToken(testSignedToken(t, key, "other", `{}`))
+		require.NoError(t, err)
+		_, err = token.Verify(jwks)
+		assert.ErrorContains(t, err, "key other not found")
+	})
+}
+
+func testUnsignedToken(t *testing.T, claims string) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg": "RS256", "kid": "test"}`))
+	return header + "." + testEncodeClaims(t, claims) + "." + base64.RawURLEncoding.EncodeToString([]byte("signature"))
+}
+
+func testSignedToken(t *testing.T, key *rsa.PrivateKey, kid, claims string) string {
+	t.Helper()
+	header, err := json.Marshal(TokenHeader{Alg: "RS256", Kid: kid, Typ: "JWT"})
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + testEncodeClaims(t, claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testEncodeClaims(t *testing.T, claims string) string {
+	t.Helper()
+	require.True(t, json.Valid([]byte(claims)))
+	return base64.RawURLEncoding.EncodeToString([]byte(claims))
+}
@@ -0,0 +1,331 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	ActionAssumeRoleWithWebIdentity = "sts:AssumeRoleWithWebIdentity"
+	ActionAssumeRole                = "sts:AssumeRole"
+	ActionTagSession                = "sts:TagSession"
+	DefaultAudience                 = "sts.amazonaws.com"
+	PodIdentityServicePrincipal     = "pods.eks.amazonaws.com"
+)
+
+type TrustCheck string
+
+const (
+	TrustCheckPolicy    TrustCheck = "policy"
+	TrustCheckPrincipal TrustCheck = "principal"
+	TrustCheckAccount   TrustCheck = "account"
+	TrustCheckRegion    TrustCheck = "region"
+	TrustCheckIssuerId  TrustCheck = "issuer id"
+	TrustCheckAction    TrustCheck = "action"
+	TrustCheckSub       TrustCheck = "sub"
+	TrustCheckAud       TrustCheck = "aud"
+	TrustCheckCondition TrustCheck = "condition"
+	TrustCheckDeny      TrustCheck = "deny"
+)
+
+// WebIdentity is the identity presented to STS (AssumeRoleWithWebIdentity) by a pod using IAM roles for service accounts
+type WebIdentity struct {
+	ProviderArn string // e.g. arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/abcxyz123
+	Issuer      string // issuer without scheme, e.g. oidc.eks.eu-west-2.amazonaws.com/id/abcxyz123
+	Subject     string // system:serviceaccount:<namespace>:<name>
+	Audience    string
+}
+
+// NewWebIdentity returns web identity of the service account in the supplied cluster, audience defaults to
+// sts.amazonaws.com if it is empty
+func NewWebIdentity(cluster Cluster, namespace, serviceAccount, audience string) WebIdentity {
+	if audience == "" {
+		audience = DefaultAudience
+	}
+	return WebIdentity{
+		ProviderArn: cluster.OidcProviderArn(),
+		Issuer:      cluster.OidcIssuerHost(),
+		Subject:     fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount),
+		Audience:    audience,
+	}
+}
+
+type TrustFailure struct {
+	Statement string
+	Check     TrustCheck
+	Message   string
+}
+
+func (t TrustFailure) String() string {
+	if t.Statement == "" {
+		return fmt.Sprintf("%s: %s", t.Check, t.Message)
+	}
+	return fmt.Sprintf("statement %s: %s: %s", t.Statement, t.Check, t.Message)
+}
+
+// TrustVerdict is result of trust policy evaluation, Statement is set to the statement that allows the web identity
+// to assume the role, Failures are set only if the web identity cannot assume the role
+type TrustVerdict struct {
+	Allowed   bool
+	Statement string
+	Failures  []TrustFailure
+}
+
+// EvaluateTrustPolicy evaluates whether the web identity can assume the role with the supplied trust policy
+func EvaluateTrustPolicy(document string, identity WebIdentity) TrustVerdict {
+	policy, err := ParsePolicyDocument(document)
+	if err != nil {
+		return TrustVerdict{Failures: []TrustFailure{{Check: TrustCheckPolicy, Message: err.Error()}}}
+	}
+	return policy.EvaluateWebIdentity(identity)
+}
+
+// EvaluateWebIdentity evaluates whether the web identity can assume the role with this (trust) policy. Explicit deny
+// takes precedence over allow, all failing checks are reported if there is no statement that allows the identity.
+func (p PolicyDocument) EvaluateWebIdentity(identity WebIdentity) TrustVerdict {
+	var allowedBy string
+	var failures, denies []TrustFailure
+	candidates := 0
+	for i, statement := range p.Statement {
+		name := statement.Name(i)
+		if statement.IsDeny() {
+			if statement.MatchesAction(ActionAssumeRoleWithWebIdentity) && statement.matchesWebIdentityPrincipal(identity) &&
+				len(statement.conditionFailures(name, identity)) == 0 {
+				denies = append(denies, TrustFailure{Statement: name, Check: TrustCheckDeny, Message: "explicit deny matches web identity"})
+			}
+			continue
+		}
+		if !statement.IsAllow() || !statement.isFederated() {
+			continue
+		}
+
+		candidates++
+		var statementFailures []TrustFailure
+		if !statement.MatchesAction(ActionAssumeRoleWithWebIdentity) {
+			msg := fmt.Sprintf("action %s does not include %s", strings.Join(statement.Action, ", "), ActionAssumeRoleWithWebIdentity)
+			statementFailures = append(statementFailures, TrustFailure{Statement: name, Check: TrustCheckAction, Message: msg})
+		}
+		statementFailures = append(statementFailures, statement.federatedFailures(name, identity)...)
+		statementFailures = append(statementFailures, statement.conditionFailures(name, identity)...)
+		if len(statementFailures) == 0 && allowedBy == "" {
+			allowedBy = name
+		}
+		failures = append(failures, statementFailures...)
+	}
+
+	if len(denies) != 0 {
+		return TrustVerdict{Failures: denies}
+	}
+	if allowedBy != "" {
+		return TrustVerdict{Allowed: true, Statement: allowedBy}
+	}
+	if candidates == 0 {
+		msg := "no Allow statement with Federated principal"
+		failures = append(failures, TrustFailure{Check: TrustCheckPrincipal, Message: msg})
+	}
+	return TrustVerdict{Failures: failures}
+}
+
+// EvaluatePodIdentityTrustPolicy evaluates whether EKS Pod Identity can assume the role with the supplied trust policy
+func EvaluatePodIdentityTrustPolicy(document string) TrustVerdict {
+	policy, err := ParsePolicyDocument(document)
+	if err != nil {
+		return TrustVerdict{Failures: []TrustFailure{{Check: TrustCheckPolicy, Message: err.Error()}}}
+	}
+	return policy.EvaluatePodIdentity()
+}
+
+// EvaluatePodIdentity evaluates whether EKS Pod Identity (pods.eks.amazonaws.com service principal) can assume the role
+// with this (trust) policy, pod identity requires both sts:AssumeRole and sts:TagSession actions. Conditions are not
+// evaluated, because they reference global condition keys (e.g. aws:SourceAccount).
+func (p PolicyDocument) EvaluatePodIdentity() TrustVerdict {
+	var failures []TrustFailure
+	var allowedBy []string
+	for _, action := range []string{ActionAssumeRole, ActionTagSession} {
+		var allowed string
+		for i, statement := range p.Statement {
+			if !statement.MatchesAction(action) || !statement.isPodIdentity() {
+				continue
+			}
+			if statement.IsDeny() && len(statement.Condition) == 0 {
+				msg := fmt.Sprintf("explicit deny of %s for %s", action, PodIdentityServicePrincipal)
+				return TrustVerdict{Failures: []TrustFailure{{Statement: statement.Name(i), Check: TrustCheckDeny, Message: msg}}}
+			}
+			if statement.IsAllow() && allowed == "" {
+				allowed = statement.Name(i)
+			}
+		}
+		if allowed == "" {
+			msg := fmt.Sprintf("no Allow statement with %s action for %s service principal", action, PodIdentityServicePrincipal)
+			failures = append(failures, TrustFailure{Check: TrustCheckAction, Message: msg})
+			continue
+		}
+		if !slices.Contains(allowedBy, allowed) {
+			allowedBy = append(allowedBy, allowed)
+		}
+	}
+
+	if len(failures) != 0 {
+		return TrustVerdict{Failures: failures}
+	}
+	return TrustVerdict{Allowed: true, Statement: strings.Join(allowedBy, ", ")}
+}
+
+// isPodIdentity returns true if the statement principal is EKS Pod Identity service principal (or wildcard)
+func (s Statement) isPodIdentity() bool {
+	return s.Principal.Wildcard || slices.Contains(s.Principal.Service, PodIdentityServicePrincipal)
+}
+
+// isFederated returns true if the statement principal can be a web identity (Federated or wildcard principal)
+func (s Statement) isFederated() bool {
+	return s.Principal.Wildcard || len(s.Principal.Federated) != 0
+}
+
+// matchesWebIdentityPrincipal returns true if the statement Principal is wildcard or contains the identity provider
+// arn, or if NotPrincipal is set and it does not contain the identity provider arn
+func (s Statement) matchesWebIdentityPrincipal(identity WebIdentity) bool {
+	if !s.NotPrincipal.IsZero() {
+		return !s.NotPrincipal.Wildcard && !slices.Contains(s.NotPrincipal.Federated, identity.ProviderArn)
+	}
+	return s.Principal.Wildcard || slices.Contains(s.Principal.Federated, identity.ProviderArn)
+}
+
+func (s Statement) federatedFailures(name string, identity WebIdentity) []TrustFailure {
+	if s.Principal.Wildcard {
+		return nil
+	}
+	for _, federated := range s.Principal.Federated {
+		if federated == identity.ProviderArn {
+			return nil
+		}
+	}
+
+	var out []TrustFailure
+	for _, federated := range s.Principal.Federated {
+		check, msg := diagnoseProviderArn(federated, identity.ProviderArn)
+		out = append(out, TrustFailure{Statement: name, Check: check, Message: msg})
+	}
+	return out
+}
+
+// diagnoseProviderArn compares federated principal with the expected oidc provider arn and returns the most specific
+// reason why they do not match
+func diagnoseProviderArn(federated, expected string) (TrustCheck, string) {
+	msg := fmt.Sprintf("federated principal %s does not match %s", federated, expected)
+	actualArn, err := arn.Parse(federated)
+	if err != nil {
+		return TrustCheckPrincipal, msg
+	}
+	expectedArn, err := arn.Parse(expected)
+	if err != nil {
+		return TrustCheckPrincipal, msg
+	}
+
+	actualRegion, actualId, ok := parseEksProviderResource(actualArn.Resource)
+	if !ok {
+		return TrustCheckPrincipal, msg
+	}
+	expectedRegion, expectedId, ok := parseEksProviderResource(expectedArn.Resource)
+	if !ok {
+		return TrustCheckPrincipal, msg
+	}
+
+	if actualArn.AccountID != expectedArn.AccountID {
+		return TrustCheckAccount, fmt.Sprintf("federated principal account %s, expected %s", actualArn.AccountID, expectedArn.AccountID)
+	}
+	if actualRegion != expectedRegion {
+		return TrustCheckRegion, fmt.Sprintf("federated principal region %s, expected %s", actualRegion, expectedRegion)
+	}
+	if !strings.EqualFold(actualId, expectedId) {
+		return TrustCheckIssuerId, fmt.Sprintf("federated principal issuer id %s, expected %s", actualId, expectedId)
+	}
+	return TrustCheckPrincipal, msg
+}
+
+// WebIdentityProviders returns federated principals of statements that allow sts:AssumeRoleWithWebIdentity
+func (p PolicyDocument) WebIdentityProviders() []string {
+	var out []string
+	for _, statement := range p.Statement {
+		if !statement.IsAllow() || !statement.MatchesAction(ActionAssumeRoleWithWebIdentity) {
+			continue
+		}
+		for _, federated := range statement.Principal.Federated {
+			if !slices.Contains(out, federated) {
+				out = append(out, federated)
+			}
+		}
+	}
+	return out
+}
+
+// EksOidcProvider returns region and issuer host of EKS oidc provider arn, ok is false if the arn is not EKS oidc
+// provider (e.g. GitHub actions provider)
+func EksOidcProvider(providerArn string) (region, issuerHost string, ok bool) {
+	a, err := arn.Parse(providerArn)
+	if err != nil {
+		return "", "", false
+	}
+	region, _, ok = parseEksProviderResource(a.Resource)
+	return region, strings.TrimPrefix(a.Resource, "oidc-provider/"), ok
+}
+
+// parseEksProviderResource parses oidc provider arn resource e.g. oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/abc
+func parseEksProviderResource(resource string) (region, id string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(resource, "oidc-provider/"), "/")
+	if len(parts) != 3 || parts[1] != "id" {
+		return "", "", false
+	}
+	hostParts := strings.Split(parts[0], ".")
+	if len(hostParts) < 4 || hostParts[0] != "oidc" || hostParts[1] != "eks" {
+		return "", "", false
+	}
+	return hostParts[2], parts[2], true
+}
+
+func (s Statement) conditionFailures(name string, identity WebIdentity) []TrustFailure {
+	var out []TrustFailure
+	for _, operator := range slices.Sorted(maps.Keys(s.Condition)) {
+		for _, key := range slices.Sorted(maps.Keys(s.Condition[operator])) {
+			values := s.Condition[operator][key]
+			issuer, claim, ok := strings.Cut(key, ":")
+			if !ok || strings.HasPrefix(key, "aws:") || strings.HasPrefix(key, "sts:") {
+				// global condition keys are not evaluated
+				continue
+			}
+			if issuer != identity.Issuer {
+				msg := fmt.Sprintf("condition key %s does not belong to issuer %s", key, identity.Issuer)
+				out = append(out, TrustFailure{Statement: name, Check: TrustCheckIssuerId, Message: msg})
+				continue
+			}
+
+			var check TrustCheck
+			var requestValue string
+			switch claim {
+			case "sub":
+				check, requestValue = TrustCheckSub, identity.Subject
+			case "aud":
+				check, requestValue = TrustCheckAud, identity.Audience
+			default:
+				continue
+			}
+
+			match, supported := conditionMatches(operator, values, []string{requestValue})
+			if !supported {
+				msg := fmt.Sprintf("%s condition operator %s is not supported, condition is not evaluated", key, operator)
+				out = append(out, TrustFailure{Statement: name, Check: TrustCheckCondition, Message: msg})
+				continue
+			}
+			if !match {
+				msg := fmt.Sprintf("%s %s %s does not match %s", operator, claim, strings.Join(values, ", "), requestValue)
+				if check == TrustCheckAud {
+					msg = fmt.Sprintf("audience %s is missing from %s %s %s", requestValue, operator, claim, strings.Join(values, ", "))
+				}
+				out = append(out, TrustFailure{Statement: name, Check: check, Message: msg})
+			}
+		}
+	}
+	return out
+}
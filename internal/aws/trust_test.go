@@ -0,0 +1,200 @@
+package aws
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testTrustPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Principal": {
+        "Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"
+      },
+      "Action": "sts:AssumeRoleWithWebIdentity",
+      "Condition": {
+        "StringEquals": {
+          "oidc.eks.eu-west-2.amazonaws.com/id/ABC:aud": "sts.amazonaws.com",
+          "oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:prometheus:ingest"
+        }
+      }
+    }
+  ]
+}`
+
+var testCluster = Cluster{
+	Arn:        "arn:aws:eks:eu-west-2:123456789123:cluster/main",
+	OidcIssuer: "https://oidc.eks.eu-west-2.amazonaws.com/id/ABC",
+}
+
+func TestParsePolicyDocument(t *testing.T) {
+	policy, err := ParsePolicyDocument(`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": ["s3:Get*", "s3:List*"], "Resource": "*"}}`)
+	require.NoError(t, err)
+	require.Len(t, policy.Statement, 1)
+
+	statement := policy.Statement[0]
+	assert.True(t, statement.IsAllow())
+	assert.True(t, statement.Principal.Wildcard)
+	assert.Equal(t, Values{"s3:Get*", "s3:List*"}, statement.Action)
+	assert.Equal(t, Values{"*"}, statement.Resource)
+	assert.True(t, statement.MatchesAction("s3:GetObject"))
+	assert.False(t, statement.MatchesAction("s3:PutObject"))
+}
+
+func TestEvaluateTrustPolicy(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		verdict := EvaluateTrustPolicy(testTrustPolicy, NewWebIdentity(testCluster, "prometheus", "ingest", ""))
+		assert.True(t, verdict.Allowed)
+		assert.Equal(t, "#0", verdict.Statement)
+		assert.Empty(t, verdict.Failures)
+	})
+
+	t.Run("sub mismatch", func(t *testing.T) {
+		verdict := EvaluateTrustPolicy(testTrustPolicy, NewWebIdentity(testCluster, "prometheus", "query", ""))
+		assert.False(t, verdict.Allowed)
+		require.Len(t, verdict.Failures, 1)
+		assert.Equal(t, TrustCheckSub, verdict.Failures[0].Check)
+	})
+
+	t.Run("aud mismatch", func(t *testing.T) {
+		verdict := EvaluateTrustPolicy(testTrustPolicy, NewWebIdentity(testCluster, "prometheus", "ingest", "custom"))
+		assert.False(t, verdict.Allowed)
+		require.Len(t, verdict.Failures, 1)
+		assert.Equal(t, TrustCheckAud, verdict.Failures[0].Check)
+	})
+
+	t.Run("wrong issuer id", func(t *testing.T) {
+		cluster := testCluster
+		cluster.OidcIssuer = "https://oidc.eks.eu-west-2.amazonaws.com/id/XYZ"
+		verdict := EvaluateTrustPolicy(testTrustPolicy, NewWebIdentity(cluster, "prometheus", "ingest", ""))
+		assert.False(t, verdict.Allowed)
+		require.NotEmpty(t, verdict.Failures)
+		assert.Equal(t, TrustCheckIssuerId, verdict.Failures[0].Check)
+	})
+
+	t.Run("wrong region", func(t *testing.T) {
+		cluster := Cluster{
+			Arn:        "arn:aws:eks:eu-west-1:123456789123:cluster/main",
+			OidcIssuer: "https://oidc.eks.eu-west-1.amazonaws.com/id/ABC",
+		}
+		verdict := EvaluateTrustPolicy(testTrustPolicy, NewWebIdentity(cluster, "prometheus", "ingest", ""))
+		assert.False(t, verdict.Allowed)
+		require.NotEmpty(t, verdict.Failures)
+		assert.Equal(t, TrustCheckRegion, verdict.Failures[0].Check)
+	})
+
+	t.Run("string like", func(t *testing.T) {
+		policy := `{"Statement": [{"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			"Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"},
+			"Condition": {"StringLike": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:prometheus:*"}}}]}`
+		verdict := EvaluateTrustPolicy(policy, NewWebIdentity(testCluster, "prometheus", "query", ""))
+		assert.True(t, verdict.Allowed)
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		policy := `{"Statement": [
+			{"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			 "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}},
+			{"Sid": "DenyDefault", "Effect": "Deny", "Action": "sts:*", "Principal": "*",
+			 "Condition": {"StringLike": {"oidc.eks.eu-west-2.amazonaws.com/id/ABC:sub": "system:serviceaccount:default:*"}}}]}`
+		verdict := EvaluateTrustPolicy(policy, NewWebIdentity(testCluster, "default", "app", ""))
+		assert.False(t, verdict.Allowed)
+		require.Len(t, verdict.Failures, 1)
+		assert.Equal(t, TrustCheckDeny, verdict.Failures[0].Check)
+		assert.Equal(t, "DenyDefault", verdict.Failures[0].Statement)
+
+		verdict = EvaluateTrustPolicy(policy, NewWebIdentity(testCluster, "prometheus", "app", ""))
+		assert.True(t, verdict.Allowed)
+	})
+
+	t.Run("deny other principals", func(t *testing.T) {
+		policy := `{"Statement": [
+			{"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			 "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}},
+			{"Effect": "Deny", "Action": "sts:*", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}},
+			{"Effect": "Deny", "Action": "sts:*", "Principal": {"Service": "ec2.amazonaws.com"}},
+			{"Effect": "Deny", "Action": "sts:*", "NotPrincipal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}}]}`
+		verdict := EvaluateTrustPolicy(policy, NewWebIdentity(testCluster, "default", "app", ""))
+		assert.True(t, verdict.Allowed)
+		assert.Empty(t, verdict.Failures)
+	})
+
+	t.Run("deny not principal", func(t *testing.T) {
+		policy := `{"Statement": [
+			{"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			 "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}},
+			{"Sid": "DenyOthers", "Effect": "Deny", "Action": "sts:*", "NotPrincipal": {"AWS": "arn:aws:iam::123456789012:root"}}]}`
+		verdict := EvaluateTrustPolicy(policy, NewWebIdentity(testCluster, "default", "app", ""))
+		assert.False(t, verdict.Allowed)
+		require.Len(t, verdict.Failures, 1)
+		assert.Equal(t, "DenyOthers", verdict.Failures[0].Statement)
+	})
+}
+
+func Test_matchWildcard(t *testing.T) {
+	tcs := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"*", "anything", true},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"system:serviceaccount:*:app", "system:serviceaccount:default:app", true},
+		{"system:serviceaccount:?:app", "system:serviceaccount:ns:app", false},
+		{"abc", "abc", true},
+		{"abc", "abcd", false},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, matchWildcard(tc.pattern, tc.value), "pattern: %s value: %s", tc.pattern, tc.value)
+	}
+}
+
+func TestEvaluatePodIdentityTrustPolicy(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		policy := `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "pods.eks.amazonaws.com"},
+			"Action": ["sts:AssumeRole", "sts:TagSession"]}]}`
+		verdict := EvaluatePodIdentityTrustPolicy(policy)
+		assert.True(t, verdict.Allowed)
+		assert.Equal(t, "#0", verdict.Statement)
+	})
+
+	t.Run("missing tag session", func(t *testing.T) {
+		policy := `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "pods.eks.amazonaws.com"},
+			"Action": "sts:AssumeRole"}]}`
+		verdict := EvaluatePodIdentityTrustPolicy(policy)
+		assert.False(t, verdict.Allowed)
+		require.Len(t, verdict.Failures, 1)
+		assert.Equal(t, TrustCheckAction, verdict.Failures[0].Check)
+	})
+
+	t.Run("irsa trust policy", func(t *testing.T) {
+		verdict := EvaluatePodIdentityTrustPolicy(testTrustPolicy)
+		assert.False(t, verdict.Allowed)
+		assert.Len(t, verdict.Failures, 2)
+	})
+}
+
+func TestPolicyDocument_WebIdentityProviders(t *testing.T) {
+	policy, err := ParsePolicyDocument(`{"Statement": [
+		{"Effect": "Allow", "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-2.amazonaws.com/id/ABC"}, "Action": "sts:AssumeRoleWithWebIdentity"},
+		{"Effect": "Allow", "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/token.actions.githubusercontent.com"}, "Action": "sts:AssumeRoleWithWebIdentity"},
+		{"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"},
+		{"Effect": "Deny", "Principal": {"Federated": "arn:aws:iam::123456789123:oidc-provider/oidc.eks.eu-west-1.amazonaws.com/id/XYZ"}, "Action": "sts:*"}]}`)
+	require.NoError(t, err)
+
+	providers := policy.WebIdentityProviders()
+	require.Len(t, providers, 2)
+
+	region, issuerHost, ok := EksOidcProvider(providers[0])
+	assert.True(t, ok)
+	assert.Equal(t, "eu-west-2", region)
+	assert.Equal(t, "oidc.eks.eu-west-2.amazonaws.com/id/ABC", issuerHost)
+
+	_, _, ok = EksOidcProvider(providers[1])
+	assert.False(t, ok)
+}
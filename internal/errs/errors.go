@@ -11,3 +11,17 @@ func NewErrNotFound(msg string) *ErrNotFound {
 func (e *ErrNotFound) Error() string {
 	return e.msg
 }
+
+// ErrForeignAccount is returned when a resource is in a different account than the caller, and there is no cross
+// account role to inspect it
+type ErrForeignAccount struct {
+	msg string
+}
+
+func NewErrForeignAccount(msg string) *ErrForeignAccount {
+	return &ErrForeignAccount{msg: msg}
+}
+
+func (e *ErrForeignAccount) Error() string {
+	return e.msg
+}
@@ -3,37 +3,82 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"github.com/pete911/kubectl-iam4sa/internal/aws"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"log/slog"
 	"strings"
 	"time"
 )
 
-const iamRoleARNAnnotation = "eks.amazonaws.com/role-arn"
+const (
+	iamRoleARNAnnotation = "eks.amazonaws.com/role-arn"
+	audienceAnnotation   = "eks.amazonaws.com/audience"
+)
+
+type Mechanism string
+
+const (
+	MechanismIRSA        Mechanism = "IRSA"
+	MechanismPodIdentity Mechanism = "PodIdentity"
+	MechanismBoth        Mechanism = "IRSA+PodIdentity"
+)
 
 type ServiceAccount struct {
-	Name       string
-	Namespace  string
-	IamRoleArn string
-	Pods       []string
+	Name                     string
+	Namespace                string
+	IamRoleArn               string // IRSA eks.amazonaws.com/role-arn annotation
+	Audience                 string // IRSA eks.amazonaws.com/audience annotation, empty if not set (sts.amazonaws.com)
+	PodIdentityAssociationId string
+	PodIdentityRoleArn       string
+	RoleArnAnnotatedAt       time.Time // approximate time of the last role arn annotation change
+	Pods                     []Pod
+}
+
+// Mechanism returns how the service account gets IAM role, both mechanisms are set on clusters that are migrating
+// from IRSA to EKS Pod Identity (or back)
+func (s ServiceAccount) Mechanism() Mechanism {
+	switch {
+	case s.IamRoleArn != "" && s.PodIdentityRoleArn != "":
+		return MechanismBoth
+	case s.PodIdentityRoleArn != "":
+		return MechanismPodIdentity
+	}
+	return MechanismIRSA
+}
+
+// RoleArn returns IRSA role arn, or EKS Pod Identity role arn if the service account does not have IRSA annotation
+func (s ServiceAccount) RoleArn() string {
+	if s.IamRoleArn != "" {
+		return s.IamRoleArn
+	}
+	return s.PodIdentityRoleArn
 }
 
 func (s ServiceAccount) RoleAccount() string {
-	parts := strings.Split(s.IamRoleArn, ":")
+	parts := strings.Split(s.RoleArn(), ":")
+	if len(parts) < 2 {
+		return ""
+	}
 	return parts[len(parts)-2]
 }
 
 func (s ServiceAccount) RoleName() string {
-	parts := strings.Split(s.IamRoleArn, "/")
+	parts := strings.Split(s.RoleArn(), "/")
 	return parts[len(parts)-1]
 }
 
 type Client struct {
-	logger *slog.Logger
-	config Kubeconfig
-	coreV1 corev1.CoreV1Interface
+	logger  *slog.Logger
+	config  Kubeconfig
+	coreV1  corev1.CoreV1Interface
+	appsV1  appsv1.AppsV1Interface
+	batchV1 batchv1.BatchV1Interface
 }
 
 func NewClient(logger *slog.Logger, config Kubeconfig) (Client, error) {
@@ -42,20 +87,41 @@ func NewClient(logger *slog.Logger, config Kubeconfig) (Client, error) {
 		return Client{}, err
 	}
 	return Client{
-		logger: logger,
-		config: config,
-		coreV1: cs.CoreV1(),
+		logger:  logger,
+		config:  config,
+		coreV1:  cs.CoreV1(),
+		appsV1:  cs.AppsV1(),
+		batchV1: cs.BatchV1(),
 	}, nil
 }
 
-func (c Client) ListIAMServiceAccounts(namespace, labelSelector, fieldSelector string) ([]ServiceAccount, error) {
+// GetServiceAccount returns service account, IamRoleArn is empty if the service account does not have role annotation
+// and pod identity fields are empty if there is no matching association
+func (c Client) GetServiceAccount(namespace, name string, associations []aws.PodIdentityAssociation) (ServiceAccount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	serviceAccount, err := c.coreV1.ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+	pods, err := c.listPods(namespace, serviceAccount.Name)
+	if err != nil {
+		return ServiceAccount{}, fmt.Errorf("list pods for %s/%s service account: %v", namespace, serviceAccount.Name, err)
+	}
+	association, _ := findPodIdentityAssociation(associations, serviceAccount.Namespace, serviceAccount.Name)
+	return toServiceAccount(*serviceAccount, association, pods), nil
+}
+
+// ListIAMServiceAccounts returns service accounts that have IRSA role annotation or EKS Pod Identity association
+func (c Client) ListIAMServiceAccounts(namespace, labelSelector, fieldSelector string, associations []aws.PodIdentityAssociation) ([]ServiceAccount, error) {
 	if namespace == "" {
-		return c.listAllIAMServiceAccounts(labelSelector, fieldSelector)
+		return c.listAllIAMServiceAccounts(labelSelector, fieldSelector, associations)
 	}
-	return c.listIAMServiceAccounts(namespace, labelSelector, fieldSelector)
+	return c.listIAMServiceAccounts(namespace, labelSelector, fieldSelector, associations)
 }
 
-func (c Client) listAllIAMServiceAccounts(labelSelector, fieldSelector string) ([]ServiceAccount, error) {
+func (c Client) listAllIAMServiceAccounts(labelSelector, fieldSelector string, associations []aws.PodIdentityAssociation) ([]ServiceAccount, error) {
 	namespaces, err := c.getNamespaces()
 	if err != nil {
 		return nil, fmt.Errorf("get namespaces: %w", err)
@@ -63,7 +129,7 @@ func (c Client) listAllIAMServiceAccounts(labelSelector, fieldSelector string) (
 
 	var allServiceAccounts []ServiceAccount
 	for _, namespace := range namespaces {
-		serviceAccounts, err := c.listIAMServiceAccounts(namespace, labelSelector, fieldSelector)
+		serviceAccounts, err := c.listIAMServiceAccounts(namespace, labelSelector, fieldSelector, associations)
 		if err != nil {
 			return nil, err
 		}
@@ -72,7 +138,7 @@ func (c Client) listAllIAMServiceAccounts(labelSelector, fieldSelector string) (
 	return allServiceAccounts, nil
 }
 
-func (c Client) listIAMServiceAccounts(namespace, labelSelector, fieldSelector string) ([]ServiceAccount, error) {
+func (c Client) listIAMServiceAccounts(namespace, labelSelector, fieldSelector string, associations []aws.PodIdentityAssociation) ([]ServiceAccount, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -83,23 +149,86 @@ func (c Client) listIAMServiceAccounts(namespace, labelSelector, fieldSelector s
 
 	var serviceAccounts []ServiceAccount
 	for _, serviceAccount := range serviceAccountList.Items {
-		if roleARN, ok := serviceAccount.Annotations[iamRoleARNAnnotation]; ok {
-			pods, err := c.listPods(namespace, serviceAccount.Name)
-			if err != nil {
-				return nil, fmt.Errorf("list pods for %s/%s service account: %v", namespace, serviceAccount.Name, err)
-			}
-			serviceAccounts = append(serviceAccounts, ServiceAccount{
-				Name:       serviceAccount.Name,
-				Namespace:  serviceAccount.Namespace,
-				IamRoleArn: roleARN,
-				Pods:       pods,
-			})
+		_, ok := serviceAccount.Annotations[iamRoleARNAnnotation]
+		association, hasAssociation := findPodIdentityAssociation(associations, serviceAccount.Namespace, serviceAccount.Name)
+		if !ok && !hasAssociation {
+			continue
+		}
+
+		pods, err := c.listPods(namespace, serviceAccount.Name)
+		if err != nil {
+			return nil, fmt.Errorf("list pods for %s/%s service account: %v", namespace, serviceAccount.Name, err)
 		}
+		serviceAccounts = append(serviceAccounts, toServiceAccount(serviceAccount, association, pods))
 	}
 	return serviceAccounts, nil
 }
 
-func (c Client) listPods(namespace, serviceAccountName string) ([]string, error) {
+func toServiceAccount(serviceAccount v1.ServiceAccount, association aws.PodIdentityAssociation, pods []Pod) ServiceAccount {
+	out := ServiceAccount{
+		Name:                     serviceAccount.Name,
+		Namespace:                serviceAccount.Namespace,
+		IamRoleArn:               serviceAccount.Annotations[iamRoleARNAnnotation],
+		Audience:                 serviceAccount.Annotations[audienceAnnotation],
+		PodIdentityAssociationId: association.AssociationId,
+		PodIdentityRoleArn:       association.RoleArn,
+		Pods:                     pods,
+	}
+	if out.IamRoleArn != "" {
+		out.RoleArnAnnotatedAt = annotationChangedAt(serviceAccount.ObjectMeta, iamRoleARNAnnotation)
+	}
+	return out
+}
+
+// annotationChangedAt returns the latest time when a field manager that owns the annotation updated the object. This is
+// approximate (manager could have updated other fields), object creation time is returned if there are no managed
+// fields.
+func annotationChangedAt(meta metav1.ObjectMeta, annotation string) time.Time {
+	key := fmt.Sprintf(`"f:%s"`, annotation)
+	var latest time.Time
+	for _, field := range meta.ManagedFields {
+		if field.FieldsV1 == nil || field.Time == nil {
+			continue
+		}
+		if strings.Contains(string(field.FieldsV1.Raw), key) && field.Time.After(latest) {
+			latest = field.Time.Time
+		}
+	}
+	if latest.IsZero() {
+		return meta.CreationTimestamp.Time
+	}
+	return latest
+}
+
+// CreateToken requests service account token with the audience (TokenRequest API), the same token that is projected
+// into pods by pod identity webhook
+func (c Client) CreateToken(namespace, name, audience string, expirationSeconds int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{audience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	out, err := c.coreV1.ServiceAccounts(namespace).CreateToken(ctx, name, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return out.Status.Token, nil
+}
+
+func findPodIdentityAssociation(associations []aws.PodIdentityAssociation, namespace, name string) (aws.PodIdentityAssociation, bool) {
+	for _, association := range associations {
+		if association.Namespace == namespace && association.ServiceAccount == name {
+			return association, true
+		}
+	}
+	return aws.PodIdentityAssociation{}, false
+}
+
+func (c Client) listPods(namespace, serviceAccountName string) ([]Pod, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -107,9 +236,9 @@ func (c Client) listPods(namespace, serviceAccountName string) ([]string, error)
 	if err != nil {
 		return nil, err
 	}
-	var out []string
+	var out []Pod
 	for _, pod := range podList.Items {
-		out = append(out, pod.Name)
+		out = append(out, toPod(pod))
 	}
 	return out, nil
 }
@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// execIdentity is cluster name, region, profile and role resolved from kubeconfig exec plugin, values are empty if
+// they could not be resolved
+type execIdentity struct {
+	clusterName string
+	region      string
+	profile     string
+	roleArn     string
+}
+
+// resolveExec resolves exec plugin arguments and environment, wrappers (e.g. granted assume, aws-vault exec) are
+// resolved by the wrapped command
+func resolveExec(command string, args []string, env map[string]string) execIdentity {
+	identity := execIdentity{
+		region:  firstNonEmpty(getFlagValue(args, "--region"), env["AWS_REGION"], env["AWS_DEFAULT_REGION"]),
+		profile: firstNonEmpty(getFlagValue(args, "--profile"), env["AWS_PROFILE"]),
+		roleArn: env["AWS_ROLE_ARN"],
+	}
+
+	switch filepath.Base(command) {
+	case "aws":
+		// aws eks get-token --cluster-name <name> [--region <region>] [--role-arn <arn>]
+		identity.clusterName = getFlagValue(args, "--cluster-name")
+		identity.roleArn = firstNonEmpty(getFlagValue(args, "--role-arn"), identity.roleArn)
+		return identity
+	case "aws-iam-authenticator":
+		// aws-iam-authenticator token -i <name> [-r <arn>]
+		identity.clusterName = getFlagValue(args, "-i", "--cluster-id")
+		identity.roleArn = firstNonEmpty(getFlagValue(args, "-r", "--role"), identity.roleArn)
+		return identity
+	case "eksctl":
+		// eksctl get-token --cluster <name> [--region <region>]
+		identity.clusterName = getFlagValue(args, "--cluster", "--name", "--cluster-name")
+		return identity
+	case "assume", "assumego", "granted":
+		// granted assume <profile> --exec '<command>'
+		identity.profile = firstNonEmpty(identity.profile, firstPositional(args))
+	case "aws-vault":
+		// aws-vault exec <profile> -- <command>
+		if len(args) > 1 && args[0] == "exec" {
+			identity.profile = firstNonEmpty(identity.profile, args[1])
+		}
+	}
+
+	for i, arg := range args {
+		// wrapped command can be a single argument (e.g. --exec 'aws eks get-token ...')
+		fields := strings.Fields(arg)
+		if len(fields) == 0 || !isExecPlugin(fields[0]) {
+			continue
+		}
+		wrapped := resolveExec(fields[0], append(fields[1:], args[i+1:]...), env)
+		wrapped.profile = firstNonEmpty(wrapped.profile, identity.profile)
+		wrapped.region = firstNonEmpty(wrapped.region, identity.region)
+		return wrapped
+	}
+	return identity
+}
+
+func isExecPlugin(command string) bool {
+	switch filepath.Base(command) {
+	case "aws", "aws-iam-authenticator", "eksctl":
+		return true
+	}
+	return false
+}
+
+// getFlagValue returns value of the first flag that is set, as '<flag> <value>' or '<flag>=<value>'
+func getFlagValue(args []string, flags ...string) string {
+	for _, flag := range flags {
+		for i := range args {
+			if args[i] == flag && len(args) > i+1 {
+				return args[i+1]
+			}
+			if v, ok := strings.CutPrefix(args[i], flag+"="); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func firstPositional(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
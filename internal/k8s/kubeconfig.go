@@ -2,77 +2,144 @@ package k8s
 
 import (
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
 )
 
+// Kubeconfig is current context rest config with EKS cluster name, region, profile and role resolved from the exec
+// plugin, cluster arn or api server endpoint. ClusterName is empty if it could not be resolved, in which case it has
+// to be looked up by the Server endpoint.
 type Kubeconfig struct {
-	RestConfig  *rest.Config
+	RestConfig     *rest.Config
+	Context        string
+	Server         string
+	ClusterName    string
+	ClusterAccount string // account from kubeconfig cluster arn, empty if the cluster is not named by arn
+	Region         string
+	Profile        string
+	RoleArn        string
+}
+
+// Overrides are explicitly set (flags) values that take precedence over values resolved from kubeconfig
+type Overrides struct {
+	Context     string // kubeconfig context, current context if empty
 	ClusterName string
 	Region      string
 	Profile     string
+	RoleArn     string
 }
 
 func (k Kubeconfig) String() string {
-	return fmt.Sprintf("cluster name: %s region %s", k.ClusterName, k.Region)
+	return fmt.Sprintf("context: %s server: %s cluster name: %s cluster account: %s region %s profile: %s role: %s",
+		k.Context, k.Server, k.ClusterName, k.ClusterAccount, k.Region, k.Profile, k.RoleArn)
 }
 
-func NewKubeconfig(kubeconfigPath string) (Kubeconfig, error) {
+func NewKubeconfig(kubeconfigPath string, overrides Overrides) (Kubeconfig, error) {
 	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-		nil)
+		&clientcmd.ConfigOverrides{CurrentContext: overrides.Context})
 
 	apiConfig, err := clientConfig.RawConfig()
 	if err != nil {
 		return Kubeconfig{}, fmt.Errorf("raw config: %v", err)
 	}
+	if overrides.Context != "" {
+		apiConfig.CurrentContext = overrides.Context
+	}
 
 	restConfig, err := clientConfig.ClientConfig()
 	if err != nil {
 		return Kubeconfig{}, fmt.Errorf("client configs: %v", err)
 	}
 
-	user := apiConfig.Contexts[apiConfig.CurrentContext].AuthInfo
-	exec := apiConfig.AuthInfos[user].Exec
-	if exec.Command != "aws" {
-		if exec.Command == "" {
-			return Kubeconfig{}, fmt.Errorf("exec command is not set in current %s contex, cannot determine cluster name and region", apiConfig.CurrentContext)
-		}
-		return Kubeconfig{}, fmt.Errorf("unexpected exec command %s for current %s contex, expected 'aws'", exec.Command, apiConfig.CurrentContext)
+	kubeContext, ok := apiConfig.Contexts[apiConfig.CurrentContext]
+	if !ok {
+		return Kubeconfig{}, fmt.Errorf("current context %s not found", apiConfig.CurrentContext)
+	}
+	var exec *api.ExecConfig
+	if authInfo, ok := apiConfig.AuthInfos[kubeContext.AuthInfo]; ok {
+		exec = authInfo.Exec
 	}
 
-	env := execEnvToMap(exec.Env)
-	return Kubeconfig{
-		RestConfig:  restConfig,
-		ClusterName: getClusterName(exec.Args),
-		Region:      getRegion(exec.Args, env),
-		Profile:     getProfile(exec.Args, env),
-	}, nil
+	out := Kubeconfig{
+		RestConfig: restConfig,
+		Context:    apiConfig.CurrentContext,
+		Server:     restConfig.Host,
+	}
+	out.resolve(exec, kubeContext.Cluster)
+	out.override(overrides)
+	return out, nil
+}
+
+// ListContexts returns sorted kubeconfig context names
+func ListContexts(kubeconfigPath string) ([]string, error) {
+	apiConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		nil).RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("raw config: %v", err)
+	}
+	return slices.Sorted(maps.Keys(apiConfig.Contexts)), nil
 }
 
-func getRegion(args []string, env map[string]string) string {
-	if v := getFlagValue(args, "--region"); v != "" {
-		return v
+// resolve sets cluster name, region, profile and role, values resolved earlier in the chain take precedence: exec
+// plugin arguments and environment, cluster arn (kubeconfig cluster name set by 'aws eks update-kubeconfig'), api
+// server endpoint
+func (k *Kubeconfig) resolve(exec *api.ExecConfig, clusterName string) {
+	if exec != nil {
+		identity := resolveExec(exec.Command, exec.Args, execEnvToMap(exec.Env))
+		k.ClusterName, k.Region, k.Profile, k.RoleArn = identity.clusterName, identity.region, identity.profile, identity.roleArn
 	}
-	return env["AWS_REGION"]
+
+	if clusterArn, ok := parseClusterArn(clusterName); ok {
+		name := strings.TrimPrefix(clusterArn.Resource, "cluster/")
+		k.ClusterName = firstNonEmpty(k.ClusterName, name)
+		k.Region = firstNonEmpty(k.Region, clusterArn.Region)
+		if k.ClusterName == name {
+			k.ClusterAccount = clusterArn.AccountID
+		}
+	}
+	k.Region = firstNonEmpty(k.Region, regionFromEndpoint(k.Server))
 }
 
-func getProfile(args []string, env map[string]string) string {
-	if v := getFlagValue(args, "--profile"); v != "" {
-		return v
+func (k *Kubeconfig) override(overrides Overrides) {
+	if overrides.ClusterName != "" && overrides.ClusterName != k.ClusterName {
+		// different cluster, account from kubeconfig cluster arn does not apply
+		k.ClusterAccount = ""
 	}
-	return env["AWS_PROFILE"]
+	k.ClusterName = firstNonEmpty(overrides.ClusterName, k.ClusterName)
+	k.Region = firstNonEmpty(overrides.Region, k.Region)
+	k.Profile = firstNonEmpty(overrides.Profile, k.Profile)
+	k.RoleArn = firstNonEmpty(overrides.RoleArn, k.RoleArn)
 }
 
-func getClusterName(args []string) string {
-	return getFlagValue(args, "--cluster-name")
+// parseClusterArn returns parsed EKS cluster arn, false if the value is not EKS cluster arn
+func parseClusterArn(value string) (arn.ARN, bool) {
+	a, err := arn.Parse(value)
+	if err != nil || a.Service != "eks" {
+		return arn.ARN{}, false
+	}
+	name, ok := strings.CutPrefix(a.Resource, "cluster/")
+	return a, ok && name != ""
 }
 
-func getFlagValue(args []string, flag string) string {
-	for i := range args {
-		if args[i] == flag && len(args) > i+1 {
-			return args[i+1]
+// regionFromEndpoint returns region from EKS api server endpoint e.g. https://ABC.gr7.eu-west-2.eks.amazonaws.com,
+// empty if the endpoint is not EKS endpoint
+func regionFromEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	for i := 1; i < len(labels); i++ {
+		if labels[i] == "eks" {
+			return labels[i-1]
 		}
 	}
 	return ""
@@ -85,3 +152,12 @@ func execEnvToMap(env []api.ExecEnvVar) map[string]string {
 	}
 	return out
 }
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
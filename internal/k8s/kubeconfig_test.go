@@ -3,22 +3,144 @@ package k8s
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
+const testStaticTokenKubeconfig = `apiVersion: v1
+kind: Config
+current-context: main
+clusters:
+- name: arn:aws:eks:eu-west-2:123456789123:cluster/main
+  cluster:
+    server: https://ABC.gr7.eu-west-2.eks.amazonaws.com
+- name: arn:aws:eks:us-east-1:123456789123:cluster/dev
+  cluster:
+    server: https://XYZ.gr7.us-east-1.eks.amazonaws.com
+contexts:
+- name: main
+  context:
+    cluster: arn:aws:eks:eu-west-2:123456789123:cluster/main
+    user: admin
+- name: dev
+  context:
+    cluster: arn:aws:eks:us-east-1:123456789123:cluster/dev
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`
+
 func Test_getFlagValue(t *testing.T) {
 	tcs := []struct {
 		args     []string
-		flag     string
+		flags    []string
 		expected string
 	}{
-		{[]string{"--profile", "default", "--region", "eu-west-2"}, "--profile", "default"},
-		{[]string{"--profile", "default", "--region", "eu-west-2"}, "--region", "eu-west-2"},
-		{[]string{"--profile", "default", "--region"}, "--region", ""},
+		{[]string{"--profile", "default", "--region", "eu-west-2"}, []string{"--profile"}, "default"},
+		{[]string{"--profile", "default", "--region", "eu-west-2"}, []string{"--region"}, "eu-west-2"},
+		{[]string{"--profile", "default", "--region"}, []string{"--region"}, ""},
+		{[]string{"--region=eu-west-2"}, []string{"--region"}, "eu-west-2"},
+		{[]string{"token", "--cluster-id", "main"}, []string{"-i", "--cluster-id"}, "main"},
+	}
+
+	for _, tc := range tcs {
+		actual := getFlagValue(tc.args, tc.flags...)
+		assert.Equal(t, tc.expected, actual, fmt.Sprintf("args: %v flags %v", tc.args, tc.flags))
+	}
+}
+
+func Test_resolveExec(t *testing.T) {
+	tcs := []struct {
+		name     string
+		command  string
+		args     []string
+		env      map[string]string
+		expected execIdentity
+	}{
+		{
+			name:     "aws cli",
+			command:  "/usr/local/bin/aws",
+			args:     []string{"--region", "eu-west-2", "eks", "get-token", "--cluster-name", "main", "--role-arn", "arn:aws:iam::123456789123:role/admin"},
+			env:      map[string]string{"AWS_PROFILE": "dev"},
+			expected: execIdentity{clusterName: "main", region: "eu-west-2", profile: "dev", roleArn: "arn:aws:iam::123456789123:role/admin"},
+		},
+		{
+			name:     "aws-iam-authenticator",
+			command:  "aws-iam-authenticator",
+			args:     []string{"token", "-i", "main", "-r", "arn:aws:iam::123456789123:role/admin"},
+			env:      map[string]string{"AWS_REGION": "eu-west-1"},
+			expected: execIdentity{clusterName: "main", region: "eu-west-1", roleArn: "arn:aws:iam::123456789123:role/admin"},
+		},
+		{
+			name:     "granted",
+			command:  "assume",
+			args:     []string{"dev", "--exec", "aws eks get-token --cluster-name main --region eu-west-2"},
+			expected: execIdentity{clusterName: "main", region: "eu-west-2", profile: "dev"},
+		},
+		{
+			name:     "aws-vault",
+			command:  "aws-vault",
+			args:     []string{"exec", "dev", "--", "aws", "eks", "get-token", "--cluster-name", "main"},
+			expected: execIdentity{clusterName: "main", profile: "dev"},
+		},
+		{
+			name:     "unknown",
+			command:  "kubelogin",
+			args:     []string{"get-token"},
+			expected: execIdentity{},
+		},
 	}
 
 	for _, tc := range tcs {
-		actual := getFlagValue(tc.args, tc.flag)
-		assert.Equal(t, tc.expected, actual, fmt.Sprintf("args: %v flag %s", tc.args, tc.flag))
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, resolveExec(tc.command, tc.args, tc.env))
+		})
 	}
 }
+
+func Test_regionFromEndpoint(t *testing.T) {
+	assert.Equal(t, "eu-west-2", regionFromEndpoint("https://ABC.gr7.eu-west-2.eks.amazonaws.com"))
+	assert.Equal(t, "cn-north-1", regionFromEndpoint("https://ABC.yl4.cn-north-1.eks.amazonaws.com.cn"))
+	assert.Equal(t, "", regionFromEndpoint("https://kubernetes.example.com:6443"))
+}
+
+func TestNewKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(testStaticTokenKubeconfig), 0600))
+
+	t.Run("static token", func(t *testing.T) {
+		kubeconfig, err := NewKubeconfig(path, Overrides{})
+		require.NoError(t, err)
+		assert.Equal(t, "main", kubeconfig.ClusterName)
+		assert.Equal(t, "123456789123", kubeconfig.ClusterAccount)
+		assert.Equal(t, "eu-west-2", kubeconfig.Region)
+		assert.Equal(t, "https://ABC.gr7.eu-west-2.eks.amazonaws.com", kubeconfig.Server)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		contexts, err := ListContexts(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dev", "main"}, contexts)
+
+		kubeconfig, err := NewKubeconfig(path, Overrides{Context: "dev"})
+		require.NoError(t, err)
+		assert.Equal(t, "dev", kubeconfig.Context)
+		assert.Equal(t, "dev", kubeconfig.ClusterName)
+		assert.Equal(t, "us-east-1", kubeconfig.Region)
+		assert.Equal(t, "https://XYZ.gr7.us-east-1.eks.amazonaws.com", kubeconfig.Server)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		kubeconfig, err := NewKubeconfig(path, Overrides{ClusterName: "other", Region: "us-east-1", Profile: "dev", RoleArn: "arn:aws:iam::123456789123:role/read"})
+		require.NoError(t, err)
+		assert.Equal(t, "other", kubeconfig.ClusterName)
+		assert.Empty(t, kubeconfig.ClusterAccount)
+		assert.Equal(t, "arn:aws:iam::123456789123:role/read", kubeconfig.RoleArn)
+		assert.Equal(t, "us-east-1", kubeconfig.Region)
+		assert.Equal(t, "dev", kubeconfig.Profile)
+	})
+}
@@ -0,0 +1,193 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	envRoleArn                     = "AWS_ROLE_ARN"
+	envWebIdentityTokenFile        = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	envStsRegionalEndpoints        = "AWS_STS_REGIONAL_ENDPOINTS"
+	envRegion                      = "AWS_REGION"
+	envDefaultRegion               = "AWS_DEFAULT_REGION"
+	envContainerCredentialsFullUri = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	tokenVolumeName                = "aws-iam-token"
+	skipContainersAnnotation       = "eks.amazonaws.com/skip-containers"
+)
+
+// Pod is a pod using service account, with environment variables and volume injected by pod identity webhook
+type Pod struct {
+	Name        string
+	Namespace   string
+	CreatedAt   time.Time
+	Phase       string
+	Owner       Owner // pod controller, empty if the pod is not controlled
+	Containers  []Container
+	TokenVolume *TokenVolume // aws-iam-token projected volume, nil if not injected
+}
+
+// Container is pod (or init) container with environment variables injected by pod identity webhook, variables are
+// empty if not injected
+type Container struct {
+	Name                        string
+	Init                        bool
+	Skipped                     bool   // listed in eks.amazonaws.com/skip-containers pod annotation, not mutated
+	RoleArn                     string // AWS_ROLE_ARN
+	WebIdentityTokenFile        string // AWS_WEB_IDENTITY_TOKEN_FILE
+	StsRegionalEndpoints        string // AWS_STS_REGIONAL_ENDPOINTS
+	Region                      string // AWS_REGION, or AWS_DEFAULT_REGION if AWS_REGION is not set
+	ContainerCredentialsFullUri string // AWS_CONTAINER_CREDENTIALS_FULL_URI injected by EKS Pod Identity
+	TokenVolumeMounted          bool   // aws-iam-token volume is mounted
+}
+
+// Injected returns true if pod identity webhook injected role arn and token file, and mounted the token volume
+func (c Container) Injected() bool {
+	return c.RoleArn != "" && c.WebIdentityTokenFile != "" && c.TokenVolumeMounted
+}
+
+// TokenVolume is projected service account token volume
+type TokenVolume struct {
+	Audience          string
+	ExpirationSeconds int64
+	Path              string
+}
+
+// RoleArn returns role arn injected in the first container, empty if no container has injected role arn
+func (p Pod) RoleArn() string {
+	if roleArns := p.RoleArns(); len(roleArns) != 0 {
+		return roleArns[0]
+	}
+	return ""
+}
+
+// RoleArns returns unique role arns injected in pod containers
+func (p Pod) RoleArns() []string {
+	var out []string
+	for _, container := range p.Containers {
+		if container.RoleArn != "" && !slices.Contains(out, container.RoleArn) {
+			out = append(out, container.RoleArn)
+		}
+	}
+	return out
+}
+
+// Injected returns true if pod identity webhook injected role arn, token file and token volume into all (non init)
+// containers, containers skipped by eks.amazonaws.com/skip-containers annotation are not checked
+func (p Pod) Injected() bool {
+	if p.TokenVolume == nil {
+		return false
+	}
+	for _, container := range p.Containers {
+		if !container.Init && !container.Skipped && !container.Injected() {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleArnMismatch returns true if injected role arn is different from the supplied (annotation) role arn. Pods read
+// the annotation only when they are created, so they need to be restarted after the annotation changes.
+func (p Pod) RoleArnMismatch(roleArn string) bool {
+	for _, injected := range p.RoleArns() {
+		if injected != roleArn {
+			return true
+		}
+	}
+	return false
+}
+
+// PodIdentityInjected returns true if EKS Pod Identity webhook injected container credentials uri
+func (p Pod) PodIdentityInjected() bool {
+	for _, container := range p.Containers {
+		if container.ContainerCredentialsFullUri != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func toPod(pod v1.Pod) Pod {
+	var owner Owner
+	if ref := metav1.GetControllerOf(&pod); ref != nil {
+		owner = Owner{Kind: ref.Kind, Name: ref.Name, Namespace: pod.Namespace}
+	}
+	out := Pod{
+		Owner:       owner,
+		Name:        pod.Name,
+		Namespace:   pod.Namespace,
+		CreatedAt:   pod.CreationTimestamp.Time,
+		Phase:       string(pod.Status.Phase),
+		TokenVolume: toTokenVolume(pod.Spec.Volumes),
+	}
+	for _, container := range pod.Spec.InitContainers {
+		out.Containers = append(out.Containers, toContainer(container, true))
+	}
+	for _, container := range pod.Spec.Containers {
+		out.Containers = append(out.Containers, toContainer(container, false))
+	}
+
+	skipped := skipContainers(pod.Annotations[skipContainersAnnotation])
+	for i := range out.Containers {
+		out.Containers[i].Skipped = slices.Contains(skipped, out.Containers[i].Name)
+	}
+	return out
+}
+
+// skipContainers returns container names from eks.amazonaws.com/skip-containers annotation (comma separated list)
+func skipContainers(annotation string) []string {
+	var out []string
+	for _, name := range strings.Split(annotation, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func toContainer(container v1.Container, init bool) Container {
+	env := make(map[string]string)
+	for _, v := range container.Env {
+		env[v.Name] = v.Value
+	}
+
+	region := env[envRegion]
+	if region == "" {
+		region = env[envDefaultRegion]
+	}
+	return Container{
+		Name:                        container.Name,
+		Init:                        init,
+		RoleArn:                     env[envRoleArn],
+		WebIdentityTokenFile:        env[envWebIdentityTokenFile],
+		StsRegionalEndpoints:        env[envStsRegionalEndpoints],
+		Region:                      region,
+		ContainerCredentialsFullUri: env[envContainerCredentialsFullUri],
+		TokenVolumeMounted:          slices.ContainsFunc(container.VolumeMounts, func(m v1.VolumeMount) bool { return m.Name == tokenVolumeName }),
+	}
+}
+
+func toTokenVolume(volumes []v1.Volume) *TokenVolume {
+	for _, volume := range volumes {
+		if volume.Name != tokenVolumeName || volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ServiceAccountToken == nil {
+				continue
+			}
+			out := &TokenVolume{
+				Audience: source.ServiceAccountToken.Audience,
+				Path:     source.ServiceAccountToken.Path,
+			}
+			if source.ServiceAccountToken.ExpirationSeconds != nil {
+				out.ExpirationSeconds = *source.ServiceAccountToken.ExpirationSeconds
+			}
+			return out
+		}
+	}
+	return nil
+}
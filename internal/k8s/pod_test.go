@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func Test_toPod(t *testing.T) {
+	expiration := int64(86400)
+	pod := v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name: "app",
+					Env: []v1.EnvVar{
+						{Name: "AWS_ROLE_ARN", Value: "arn:aws:iam::123456789123:role/old"},
+						{Name: "AWS_WEB_IDENTITY_TOKEN_FILE", Value: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"},
+						{Name: "AWS_STS_REGIONAL_ENDPOINTS", Value: "regional"},
+						{Name: "AWS_DEFAULT_REGION", Value: "eu-west-2"},
+					},
+					VolumeMounts: []v1.VolumeMount{{Name: "aws-iam-token"}},
+				},
+				{Name: "sidecar"},
+			},
+			Volumes: []v1.Volume{{
+				Name: "aws-iam-token",
+				VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{{
+					ServiceAccountToken: &v1.ServiceAccountTokenProjection{Audience: "sts.amazonaws.com", ExpirationSeconds: &expiration, Path: "token"},
+				}}}},
+			}},
+		},
+	}
+	pod.Name = "app-abc"
+	pod.Annotations = map[string]string{"eks.amazonaws.com/skip-containers": "sidecar, debug"}
+
+	actual := toPod(pod)
+	require.Len(t, actual.Containers, 2)
+	assert.Equal(t, "eu-west-2", actual.Containers[0].Region)
+	assert.Equal(t, "regional", actual.Containers[0].StsRegionalEndpoints)
+	assert.True(t, actual.Containers[0].Injected())
+	assert.False(t, actual.Containers[1].Injected())
+	require.NotNil(t, actual.TokenVolume)
+	assert.Equal(t, "sts.amazonaws.com", actual.TokenVolume.Audience)
+	assert.Equal(t, int64(86400), actual.TokenVolume.ExpirationSeconds)
+
+	// sidecar container was not mutated, because it is skipped
+	assert.True(t, actual.Containers[1].Skipped)
+	assert.True(t, actual.Injected())
+	actual.Containers[1].Skipped = false
+	assert.False(t, actual.Injected())
+	assert.True(t, actual.RoleArnMismatch("arn:aws:iam::123456789123:role/new"))
+	assert.False(t, actual.RoleArnMismatch("arn:aws:iam::123456789123:role/old"))
+}
@@ -0,0 +1,149 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"strings"
+	"time"
+)
+
+const (
+	OwnerKindPod         = "Pod"
+	OwnerKindDeployment  = "Deployment"
+	OwnerKindStatefulSet = "StatefulSet"
+	OwnerKindDaemonSet   = "DaemonSet"
+	OwnerKindReplicaSet  = "ReplicaSet"
+	OwnerKindJob         = "Job"
+	OwnerKindCronJob     = "CronJob"
+
+	StaleReasonNotInjected  = "role not injected"
+	StaleReasonRoleMismatch = "role mismatch"
+)
+
+// Owner is workload that owns (controls) pod
+type Owner struct {
+	Kind      string
+	Name      string
+	Namespace string
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("%s/%s", strings.ToLower(o.Kind), o.Name)
+}
+
+// RolloutRestartable returns true if the owner can be restarted with 'kubectl rollout restart'
+func (o Owner) RolloutRestartable() bool {
+	return o.Kind == OwnerKindDeployment || o.Kind == OwnerKindStatefulSet || o.Kind == OwnerKindDaemonSet
+}
+
+// RestartCommand returns kubectl command that restarts the owner pods
+func (o Owner) RestartCommand() string {
+	if o.RolloutRestartable() {
+		return fmt.Sprintf("kubectl rollout restart -n %s %s", o.Namespace, o)
+	}
+	if o.Kind == OwnerKindPod {
+		return fmt.Sprintf("kubectl delete pod -n %s %s", o.Namespace, o.Name)
+	}
+	return fmt.Sprintf("%s cannot be restarted, delete and re-create it", o)
+}
+
+// StalePod is a pod that needs to be restarted, because it does not have the current service account role injected
+type StalePod struct {
+	Pod                     Pod
+	Reason                  string
+	Owner                   Owner // resolved workload e.g. deployment instead of replica set
+	CreatedBeforeAnnotation bool  // pod was created before the last (approximate) role annotation change
+}
+
+// StalePods returns pods that have different role injected than the service account role annotation, or pods that do
+// not have the role injected at all (created before the annotation was set, or not mutated by the webhook). If the
+// pod owner cannot be resolved (e.g. replica set was already deleted), the pod direct owner is used.
+func (c Client) StalePods(sa ServiceAccount) []StalePod {
+	if sa.IamRoleArn == "" {
+		return nil
+	}
+
+	var out []StalePod
+	for _, pod := range sa.Pods {
+		var reason string
+		switch {
+		case pod.RoleArn() == "":
+			reason = StaleReasonNotInjected
+		case pod.RoleArnMismatch(sa.IamRoleArn):
+			reason = StaleReasonRoleMismatch
+		default:
+			continue
+		}
+
+		owner, err := c.resolveOwner(pod)
+		if err != nil {
+			c.logger.Warn(fmt.Sprintf("resolve %s/%s pod owner: %v, using %s", pod.Namespace, pod.Name, err, pod.Owner))
+			owner = pod.Owner
+		}
+		out = append(out, StalePod{
+			Pod:                     pod,
+			Reason:                  reason,
+			Owner:                   owner,
+			CreatedBeforeAnnotation: pod.CreatedAt.Before(sa.RoleArnAnnotatedAt),
+		})
+	}
+	return out
+}
+
+// resolveOwner returns top level workload of the pod, e.g. deployment for pod owned by replica set
+func (c Client) resolveOwner(pod Pod) (Owner, error) {
+	if pod.Owner.Kind == "" {
+		return Owner{Kind: OwnerKindPod, Name: pod.Name, Namespace: pod.Namespace}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var ownerReferences []metav1.OwnerReference
+	switch pod.Owner.Kind {
+	case OwnerKindReplicaSet:
+		replicaSet, err := c.appsV1.ReplicaSets(pod.Namespace).Get(ctx, pod.Owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return Owner{}, err
+		}
+		ownerReferences = replicaSet.OwnerReferences
+	case OwnerKindJob:
+		job, err := c.batchV1.Jobs(pod.Namespace).Get(ctx, pod.Owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return Owner{}, err
+		}
+		ownerReferences = job.OwnerReferences
+	}
+
+	for _, ref := range ownerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return Owner{Kind: ref.Kind, Name: ref.Name, Namespace: pod.Namespace}, nil
+		}
+	}
+	return pod.Owner, nil
+}
+
+// RolloutRestart restarts deployment, stateful set or daemon set the same way as 'kubectl rollout restart', by setting
+// restartedAt annotation on pod template
+func (c Client) RolloutRestart(owner Owner) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+	opts := metav1.PatchOptions{FieldManager: "kubectl-iam4sa"}
+
+	var err error
+	switch owner.Kind {
+	case OwnerKindDeployment:
+		_, err = c.appsV1.Deployments(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, []byte(patch), opts)
+	case OwnerKindStatefulSet:
+		_, err = c.appsV1.StatefulSets(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, []byte(patch), opts)
+	case OwnerKindDaemonSet:
+		_, err = c.appsV1.DaemonSets(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, []byte(patch), opts)
+	default:
+		return fmt.Errorf("%s cannot be restarted", owner)
+	}
+	return err
+}
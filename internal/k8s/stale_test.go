@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestClient_StalePods(t *testing.T) {
+	controller := true
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-7d9f",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "app", Controller: &controller}},
+	}}
+	cs := fake.NewClientset(replicaSet)
+	client := Client{logger: slog.Default(), coreV1: cs.CoreV1(), appsV1: cs.AppsV1(), batchV1: cs.BatchV1()}
+
+	annotatedAt := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	sa := ServiceAccount{
+		Name:               "app",
+		Namespace:          "default",
+		IamRoleArn:         "arn:aws:iam::123456789123:role/new",
+		RoleArnAnnotatedAt: annotatedAt,
+		Pods: []Pod{
+			{
+				Name:       "app-7d9f-abc",
+				Namespace:  "default",
+				CreatedAt:  annotatedAt.Add(-time.Hour),
+				Owner:      Owner{Kind: OwnerKindReplicaSet, Name: "app-7d9f", Namespace: "default"},
+				Containers: []Container{{Name: "app", RoleArn: "arn:aws:iam::123456789123:role/old"}},
+			},
+			{
+				Name:       "app-7d9f-def",
+				Namespace:  "default",
+				CreatedAt:  annotatedAt.Add(time.Hour),
+				Owner:      Owner{Kind: OwnerKindReplicaSet, Name: "app-7d9f", Namespace: "default"},
+				Containers: []Container{{Name: "app", RoleArn: "arn:aws:iam::123456789123:role/new"}},
+			},
+			{
+				Name:       "worker-5c8b-abc",
+				Namespace:  "default",
+				CreatedAt:  annotatedAt.Add(-time.Hour),
+				Owner:      Owner{Kind: OwnerKindReplicaSet, Name: "worker-5c8b", Namespace: "default"},
+				Containers: []Container{{Name: "worker", RoleArn: "arn:aws:iam::123456789123:role/old"}},
+			},
+			{
+				Name:       "debug",
+				Namespace:  "default",
+				CreatedAt:  annotatedAt.Add(-time.Hour),
+				Containers: []Container{{Name: "debug"}},
+			},
+		},
+	}
+
+	stalePods := client.StalePods(sa)
+	require.Len(t, stalePods, 3)
+
+	assert.Equal(t, StaleReasonRoleMismatch, stalePods[0].Reason)
+	assert.Equal(t, Owner{Kind: OwnerKindDeployment, Name: "app", Namespace: "default"}, stalePods[0].Owner)
+	assert.True(t, stalePods[0].CreatedBeforeAnnotation)
+	assert.Equal(t, "kubectl rollout restart -n default deployment/app", stalePods[0].Owner.RestartCommand())
+
+	// deleted replica set falls back to the pod owner
+	assert.Equal(t, Owner{Kind: OwnerKindReplicaSet, Name: "worker-5c8b", Namespace: "default"}, stalePods[1].Owner)
+
+	assert.Equal(t, StaleReasonNotInjected, stalePods[2].Reason)
+	assert.Equal(t, Owner{Kind: OwnerKindPod, Name: "debug", Namespace: "default"}, stalePods[2].Owner)
+	assert.False(t, stalePods[2].Owner.RolloutRestartable())
+}
+
+func TestClient_RolloutRestart(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	cs := fake.NewClientset(deployment)
+	client := Client{logger: slog.Default(), appsV1: cs.AppsV1()}
+
+	require.NoError(t, client.RolloutRestart(Owner{Kind: OwnerKindDeployment, Name: "app", Namespace: "default"}))
+	actual, err := cs.AppsV1().Deployments("default").Get(t.Context(), "app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, actual.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"])
+
+	assert.Error(t, client.RolloutRestart(Owner{Kind: OwnerKindJob, Name: "migrate", Namespace: "default"}))
+}
@@ -0,0 +1,85 @@
+package out
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// APIVersion is version of machine readable (json, yaml) output schema, breaking changes to the schema require
+// new version
+const APIVersion = "kubectl-iam4sa/v1"
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+func ParseFormat(format string) (Format, error) {
+	switch f := Format(strings.ToLower(format)); f {
+	case FormatText, FormatJSON, FormatYAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid output format %s, expected text, json or yaml", format)
+}
+
+// Document is versioned machine readable output
+type Document struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Data       any    `json:"data"`
+}
+
+type Output struct {
+	logger *slog.Logger
+	format Format
+	writer io.Writer
+}
+
+func NewOutput(logger *slog.Logger, format Format) Output {
+	return Output{
+		logger: logger,
+		format: format,
+		writer: os.Stdout,
+	}
+}
+
+// IsText returns true if the output is human readable text
+func (o Output) IsText() bool {
+	return o.format == FormatText
+}
+
+// Print renders data as versioned document for json and yaml format, or calls text function for text format
+func (o Output) Print(kind string, data any, text func()) {
+	if o.IsText() {
+		text()
+		return
+	}
+
+	b, err := o.marshal(Document{APIVersion: APIVersion, Kind: kind, Data: data})
+	if err != nil {
+		o.logger.Error(fmt.Sprintf("output: marshal %s %s: %v", kind, o.format, err))
+		return
+	}
+	if _, err := o.writer.Write(b); err != nil {
+		o.logger.Error(fmt.Sprintf("output: write %s %s: %v", kind, o.format, err))
+	}
+}
+
+func (o Output) marshal(document Document) ([]byte, error) {
+	if o.format == FormatYAML {
+		return yaml.Marshal(document)
+	}
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
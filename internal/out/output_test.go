@@ -0,0 +1,40 @@
+package out
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+)
+
+func TestOutput_Print(t *testing.T) {
+	data := struct {
+		Name string `json:"name"`
+	}{Name: "test"}
+
+	tcs := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatJSON, "{\n  \"apiVersion\": \"kubectl-iam4sa/v1\",\n  \"kind\": \"Test\",\n  \"data\": {\n    \"name\": \"test\"\n  }\n}\n"},
+		{FormatYAML, "apiVersion: kubectl-iam4sa/v1\ndata:\n  name: test\nkind: Test\n"},
+		{FormatText, "text"},
+	}
+
+	for _, tc := range tcs {
+		buf := &bytes.Buffer{}
+		output := Output{logger: slog.Default(), format: tc.format, writer: buf}
+		output.Print("Test", data, func() { buf.WriteString("text") })
+		assert.Equal(t, tc.expected, buf.String(), "format: %s", tc.format)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("JSON")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}